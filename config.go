@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Duration lets durations be written like "30s" in the config
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// CommandConfig holds the settings every command understands.
+// The prefix and admin are shared by all commands so they are copied
+// in from the top level of the config rather than read from each section.
+type CommandConfig struct {
+	Prefix  string   `toml:"-"`
+	Admin   string   `toml:"-"`
+	Enabled bool     `toml:"enabled"`
+	Timeout Duration `toml:"timeout"`
+}
+
+type GiphyConfig struct {
+	CommandConfig
+	Key string `toml:"key"`
+}
+
+// PlusConfig limits how quickly pluses can be handed out.
+// A zero limit turns that limit off.
+type PlusConfig struct {
+	CommandConfig
+	// How long a user has to wait before changing the same target again
+	Cooldown Duration `toml:"cooldown"`
+	// How many pluses and minuses a user can give in a day
+	DailyBudget int `toml:"daily_budget"`
+	// How many minuses in a row a user can give one target
+	MaxConsecutiveMinuses int `toml:"max_consecutive_minuses"`
+	// Whether alice++ or bob-- anywhere in a message counts
+	Inline bool `toml:"inline"`
+	// Reacting to a message with this emoji gives its author a plus.
+	// Empty turns it off.
+	ReactionEmoji string `toml:"reaction_emoji"`
+	// Whether replies to reactions go in a thread on the message
+	ReactionThread bool `toml:"reaction_thread"`
+}
+
+type CallbackConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Channel the callback posts to. Empty means the admin IM.
+	Channel string `toml:"channel"`
+}
+
+type Config struct {
+	Token    string `toml:"token"`
+	Admin    string `toml:"admin"`
+	Prefix   string `toml:"prefix"`
+	Database string `toml:"database"`
+	Listen   string `toml:"listen"`
+	// Number of messages that can be handled at the same time
+	Workers int `toml:"workers"`
+
+	Commands struct {
+		Help             CommandConfig `toml:"help"`
+		Plus             PlusConfig    `toml:"plus"`
+		PlusDenomination CommandConfig `toml:"plus_denomination"`
+		PlusLeaderboard  CommandConfig `toml:"plus_leaderboard"`
+		PlusWhy          CommandConfig `toml:"plus_why"`
+		PlusAlias        CommandConfig `toml:"plus_alias"`
+		PlusSeason       CommandConfig `toml:"plus_season"`
+		PlusGraph        CommandConfig `toml:"plus_graph"`
+		PlusWallet       CommandConfig `toml:"plus_wallet"`
+		PlusShop         CommandConfig `toml:"plus_shop"`
+		Gif              CommandConfig `toml:"gif"`
+		Giphy            GiphyConfig   `toml:"giphy"`
+		Halt             CommandConfig `toml:"halt"`
+		Update           CommandConfig `toml:"update"`
+		Learn            CommandConfig `toml:"learn"`
+		React            CommandConfig `toml:"react"`
+	} `toml:"commands"`
+
+	Callbacks struct {
+		Sonarr CallbackConfig `toml:"sonarr"`
+	} `toml:"callbacks"`
+}
+
+// Environment variables that override values from the config file.
+// Secrets like the bot token are best supplied this way.
+var configEnv = map[string]func(c *Config, val string){
+	"SLACKCAT_TOKEN":          func(c *Config, val string) { c.Token = val },
+	"SLACKCAT_ADMIN":          func(c *Config, val string) { c.Admin = val },
+	"SLACKCAT_PREFIX":         func(c *Config, val string) { c.Prefix = val },
+	"SLACKCAT_DATABASE":       func(c *Config, val string) { c.Database = val },
+	"SLACKCAT_LISTEN":         func(c *Config, val string) { c.Listen = val },
+	"SLACKCAT_GIPHY_KEY":      func(c *Config, val string) { c.Commands.Giphy.Key = val },
+	"SLACKCAT_SONARR_CHANNEL": func(c *Config, val string) { c.Callbacks.Sonarr.Channel = val },
+}
+
+// LoadConfig reads the config file at path (if it exists) and applies
+// any environment variable overrides. Call Validate on the result. A missing
+// file is only an error when required is set, otherwise the defaults
+// and environment are used on their own.
+func LoadConfig(path string, required bool) (*Config, error) {
+	cfg, err := defaultConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(path)
+	if err == nil {
+		md, err := toml.DecodeFile(path, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse config %s: %v", path, err)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown config key %q in %s", undecoded[0].String(), path)
+		}
+	} else if !os.IsNotExist(err) || required {
+		return nil, fmt.Errorf("could not read config %s: %v", path, err)
+	}
+
+	for env, set := range configEnv {
+		if val, ok := os.LookupEnv(env); ok {
+			set(cfg, val)
+		}
+	}
+
+	cfg.applyShared()
+	return cfg, nil
+}
+
+// Validate checks the config for mistakes. The slack token and admin
+// are only required when requireSlack is set, so that things like the
+// console can run without them.
+func (c *Config) Validate(requireSlack bool) error {
+	if requireSlack && c.Token == "" {
+		return fmt.Errorf("config: token is required (or set SLACKCAT_TOKEN)")
+	}
+
+	if requireSlack && c.Admin == "" {
+		return fmt.Errorf("config: admin slack user id is required (or set SLACKCAT_ADMIN)")
+	}
+
+	if c.Prefix == "" || strings.ContainsAny(c.Prefix, " \t\n") {
+		return fmt.Errorf("config: prefix %q must be non-empty and contain no whitespace", c.Prefix)
+	}
+
+	if c.Database == "" {
+		return fmt.Errorf("config: database path is required")
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return fmt.Errorf("config: invalid listen address %q: %v", c.Listen, err)
+	}
+
+	if c.Workers < 1 {
+		return fmt.Errorf("config: workers must be at least 1")
+	}
+
+	for name, cmd := range c.commandConfigs() {
+		if cmd.Timeout.Duration <= 0 {
+			return fmt.Errorf("config: commands.%s.timeout must be greater than zero", name)
+		}
+	}
+
+	plus := c.Commands.Plus
+	if plus.Cooldown.Duration < 0 || plus.DailyBudget < 0 || plus.MaxConsecutiveMinuses < 0 {
+		return fmt.Errorf("config: commands.plus limits can't be negative")
+	}
+
+	if c.Commands.Giphy.Enabled && c.Commands.Giphy.Key == "" {
+		return fmt.Errorf("config: commands.giphy.key is required when giphy is enabled")
+	}
+
+	return nil
+}
+
+func (c *Config) applyShared() {
+	for _, cmd := range c.commandConfigs() {
+		cmd.Prefix = c.Prefix
+		cmd.Admin = c.Admin
+	}
+}
+
+// Command configs keyed by the name the command is registered under
+func (c *Config) commandConfigs() map[string]*CommandConfig {
+	return map[string]*CommandConfig{
+		"help":              &c.Commands.Help,
+		"plus":              &c.Commands.Plus.CommandConfig,
+		"plus_denomination": &c.Commands.PlusDenomination,
+		"plus_leaderboard":  &c.Commands.PlusLeaderboard,
+		"plus_why":          &c.Commands.PlusWhy,
+		"plus_alias":        &c.Commands.PlusAlias,
+		"plus_season":       &c.Commands.PlusSeason,
+		"plus_graph":        &c.Commands.PlusGraph,
+		"plus_wallet":       &c.Commands.PlusWallet,
+		"plus_shop":         &c.Commands.PlusShop,
+		"gif":               &c.Commands.Gif,
+		"giphy":             &c.Commands.Giphy.CommandConfig,
+		"halt":              &c.Commands.Halt,
+		"update":            &c.Commands.Update,
+		"learn":             &c.Commands.Learn,
+		"react":             &c.Commands.React,
+	}
+}
+
+func defaultConfig() (*Config, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine executable location: %v", err)
+	}
+
+	cfg := &Config{
+		Prefix:   "?",
+		Database: filepath.Join(filepath.Dir(exe), "slackcat.db"),
+		Listen:   ":8080",
+		Workers:  4,
+	}
+
+	for _, cmd := range cfg.commandConfigs() {
+		cmd.Enabled = true
+		cmd.Timeout.Duration = 10 * time.Second
+	}
+
+	//Pulling and recompiling takes a while
+	cfg.Commands.Update.Timeout.Duration = 5 * time.Minute
+
+	cfg.Commands.Plus.Cooldown.Duration = time.Minute
+	cfg.Commands.Plus.DailyBudget = 20
+	cfg.Commands.Plus.MaxConsecutiveMinuses = 3
+	cfg.Commands.Plus.Inline = true
+	cfg.Commands.Plus.ReactionEmoji = "heavy_plus_sign"
+	cfg.Commands.Plus.ReactionThread = true
+
+	//Spending pluses changes what they mean so it has to be asked for
+	cfg.Commands.PlusWallet.Enabled = false
+	cfg.Commands.PlusShop.Enabled = false
+
+	cfg.Commands.Giphy.Key = "dc6zaTOxFJmzC" //Giphy's public beta key
+	cfg.Callbacks.Sonarr.Enabled = true
+
+	return cfg, nil
+}
+
+// Default config location is next to the executable
+func defaultConfigPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "slackcat.toml"
+	}
+
+	return filepath.Join(filepath.Dir(exe), "slackcat.toml")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fake ids the console user and channel are registered under
+const consoleUserID = "UCONSOLE"
+const consoleChannelID = "CCONSOLE"
+
+type ConsoleOptions struct {
+	User     string
+	Channel  string
+	Database string
+}
+
+func newConsoleFlags(opts *ConsoleOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("console", flag.ContinueOnError)
+	fs.StringVar(&opts.User, "user", "console", "name of the user messages are sent as")
+	fs.StringVar(&opts.Channel, "channel", "console", "name of the channel messages are sent to")
+	fs.StringVar(&opts.Database, "db", "slackcat-console.db", "scratch sqlite database to use")
+
+	return fs
+}
+
+// ParseConsoleOptions doesn't print anything itself, callers should
+// report the error and follow it with PrintConsoleUsage. Asking for -h
+// returns flag.ErrHelp.
+func ParseConsoleOptions(args []string) (*ConsoleOptions, error) {
+	opts := &ConsoleOptions{}
+	fs := newConsoleFlags(opts)
+	fs.SetOutput(ioutil.Discard)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected console arguments: %v", fs.Args())
+	}
+
+	return opts, nil
+}
+
+func PrintConsoleUsage(w io.Writer) {
+	fs := newConsoleFlags(&ConsoleOptions{})
+	fs.SetOutput(w)
+
+	fmt.Fprintln(w, "Usage: slackcat console [-user <NAME>] [-channel <NAME>] [-db <PATH>]")
+	fs.PrintDefaults()
+}
+
+// RunConsole feeds each line read from in to the commands as if the
+// console user had typed it in the console channel, and writes any
+// replies or reactions to out. It returns when in is exhausted or a
+// command disconnects (like ?halt).
+func RunConsole(cfg *Config, db *sql.DB, opts *ConsoleOptions, in io.Reader, out io.Writer) {
+	//Keep log lines out of the way of the conversation
+	logger.Out = os.Stderr
+	logger.Formatter = &logrus.TextFormatter{}
+
+	//Nobody else is around so the console user gets to run admin commands
+	cfg.Admin = consoleUserID
+	cfg.applyShared()
+
+	chat := NewMemoryTransport()
+	chat.AddUser(consoleUserID, opts.User)
+	chat.AddChannel(consoleChannelID, opts.Channel)
+
+	router, err := buildRouter(chat, db, cfg)
+	defer router.Close()
+	if err != nil {
+		fmt.Fprintf(out, "%v\n", err)
+		return
+	}
+
+	prompt := fmt.Sprintf("%s@#%s> ", opts.User, opts.Channel)
+	scanner := bufio.NewScanner(in)
+
+	fmt.Fprintf(out, "slack cat console, type %shelp to see what's available\n", cfg.Prefix)
+	fmt.Fprint(out, prompt)
+
+	for scanner.Scan() {
+		txt := strings.TrimSpace(scanner.Text())
+		if txt != "" {
+			msg := &Message{
+				User:      consoleUserID,
+				Channel:   consoleChannelID,
+				Text:      txt,
+				Timestamp: strconv.FormatInt(time.Now().UnixNano(), 10),
+			}
+
+			router.Dispatch(context.Background(), chat, msg)
+
+			sent, reactions, uploads := chat.Flush()
+			for _, r := range reactions {
+				fmt.Fprintf(out, "  [reacted :%s:]\n", r.Emoji)
+			}
+
+			for _, u := range uploads {
+				fmt.Fprintf(out, "  [uploaded %s, %d bytes]\n", u.Filename, len(u.Content))
+			}
+
+			for _, m := range sent {
+				fmt.Fprintf(out, "slackcat: %s\n", m.Text)
+			}
+
+			if chat.IsDisconnected() {
+				return
+			}
+		}
+
+		fmt.Fprint(out, prompt)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// How many messages can be waiting on a channel before more are dropped
+const executorQueueSize = 64
+
+// Executor handles messages from each channel in the order they arrived,
+// on a goroutine of the channel's own, so a slow command only holds up
+// its own channel. No more than workers messages are handled at the same
+// time across every channel. Reactions are queued the same way, by the
+// channel of the message they were added to.
+type Executor struct {
+	router *Router
+	chat   ChatClient
+	slots  chan struct{}
+	mu     sync.Mutex
+	queues map[string][]func(ctx context.Context) //Waiting messages by channel, only while it has a goroutine
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Submit queues msg for handling. It never blocks, so one busy channel
+// can't stop messages being read for the others.
+func (e *Executor) Submit(msg *Message) {
+	e.enqueue(msg.Channel, func(ctx context.Context) {
+		e.router.Dispatch(ctx, e.chat, msg)
+	})
+}
+
+// SubmitReaction queues r for handling the same way Submit does
+func (e *Executor) SubmitReaction(r *Reaction) {
+	e.enqueue(r.Channel, func(ctx context.Context) {
+		e.router.DispatchReaction(ctx, e.chat, r)
+	})
+}
+
+func (e *Executor) enqueue(channel string, handle func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return
+	}
+
+	queue, running := e.queues[channel]
+	if len(queue) >= executorQueueSize {
+		logger.WithField("channel", channel).Warn("too many messages waiting, dropping one")
+		return
+	}
+
+	e.queues[channel] = append(queue, handle)
+	if !running {
+		e.wg.Add(1)
+		go e.work(channel)
+	}
+}
+
+// Close waits for queued messages to be handled then stops the workers.
+func (e *Executor) Close() {
+	e.mu.Lock()
+	e.closed = true
+	e.mu.Unlock()
+
+	e.wg.Wait()
+	e.cancel()
+}
+
+// Handles a channel's messages until none are left waiting
+func (e *Executor) work(channel string) {
+	defer e.wg.Done()
+
+	for {
+		e.mu.Lock()
+		queue := e.queues[channel]
+		if len(queue) == 0 {
+			delete(e.queues, channel)
+			e.mu.Unlock()
+			return
+		}
+
+		handle := queue[0]
+		e.queues[channel] = queue[1:]
+		e.mu.Unlock()
+
+		e.slots <- struct{}{}
+		handle(e.ctx)
+		<-e.slots
+	}
+}
+
+func NewExecutor(router *Router, chat ChatClient, workers int) *Executor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Executor{
+		router: router,
+		chat:   chat,
+		slots:  make(chan struct{}, workers),
+		queues: make(map[string][]func(ctx context.Context)),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
@@ -0,0 +1,465 @@
+// Package fakeslack is a local stand-in for the parts of the slack web
+// and RTM APIs that slack cat uses. Point the slack library at it with
+//
+//	slack.SLACK_API = server.APIURL()
+//
+// then inject events with SendEvent and assert on what the bot sent back.
+package fakeslack
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotID is the user id the fake server reports for the connected bot
+const BotID = "UBOT"
+
+// Frame is a message the bot sent over the RTM websocket
+type Frame struct {
+	ID              int    `json:"id"`
+	Type            string `json:"type"`
+	Channel         string `json:"channel"`
+	Text            string `json:"text"`
+	ThreadTimestamp string `json:"thread_ts"`
+}
+
+// PostedMessage is a message the bot sent with chat.postMessage
+type PostedMessage struct {
+	Channel string
+	Text    string
+}
+
+// Upload is a file the bot sent with files.upload
+type Upload struct {
+	Channels string
+	Filename string
+	Title    string
+	Content  []byte
+}
+
+// Reaction is a reaction the bot added with reactions.add
+type Reaction struct {
+	Name      string
+	Channel   string
+	Timestamp string
+}
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type channel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Server struct {
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	conn      *websocket.Conn
+	connMu    sync.Mutex //Serializes writes to conn
+	users     map[string]user
+	channels  map[string]channel
+	frames    []Frame
+	posted    []PostedMessage
+	reactions []Reaction
+	uploads   []Upload
+	ims       []string
+	ts        int64
+}
+
+// APIURL is the value slack.SLACK_API should be set to
+func (s *Server) APIURL() string {
+	return s.srv.URL + "/"
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+
+	s.srv.Close()
+}
+
+func (s *Server) AddUser(id string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[id] = user{id, name}
+}
+
+func (s *Server) AddChannel(id string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels[id] = channel{id, name}
+}
+
+// WaitForConnection blocks until the bot has connected to the websocket
+func (s *Server) WaitForConnection(timeout time.Duration) error {
+	return s.wait(timeout, func() bool { return s.conn != nil })
+}
+
+// SendEvent writes an RTM event (anything that marshals to json
+// with a "type" field) to the connected bot.
+func (s *Server) SendEvent(event interface{}) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("fakeslack: no websocket connection")
+	}
+
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	return conn.WriteJSON(event)
+}
+
+// SendMessage injects a message event as if user typed text in channel.
+// It returns the timestamp given to the message.
+func (s *Server) SendMessage(user string, channel string, text string) (string, error) {
+	ts := s.nextTimestamp()
+	err := s.SendEvent(map[string]string{
+		"type":    "message",
+		"user":    user,
+		"channel": channel,
+		"text":    text,
+		"ts":      ts,
+	})
+
+	return ts, err
+}
+
+// SendReaction injects a reaction_added event, or reaction_removed if
+// removed is set, for emoji on the message at ts that itemUser wrote.
+func (s *Server) SendReaction(user string, itemUser string, channel string, ts string, emoji string, removed bool) error {
+	kind := "reaction_added"
+	if removed {
+		kind = "reaction_removed"
+	}
+
+	return s.SendEvent(map[string]interface{}{
+		"type":      kind,
+		"user":      user,
+		"item_user": itemUser,
+		"reaction":  emoji,
+		"item":      map[string]string{"type": "message", "channel": channel, "ts": ts},
+		"event_ts":  s.nextTimestamp(),
+	})
+}
+
+// WaitForFrames blocks until the bot has sent at least n RTM frames
+// (pings aside) and returns everything it has sent so far.
+func (s *Server) WaitForFrames(n int, timeout time.Duration) ([]Frame, error) {
+	err := s.wait(timeout, func() bool { return len(s.frames) >= n })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Frame(nil), s.frames...), err
+}
+
+// WaitForReactions blocks until the bot has added at least n reactions.
+func (s *Server) WaitForReactions(n int, timeout time.Duration) ([]Reaction, error) {
+	err := s.wait(timeout, func() bool { return len(s.reactions) >= n })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Reaction(nil), s.reactions...), err
+}
+
+func (s *Server) PostedMessages() []PostedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]PostedMessage(nil), s.posted...)
+}
+
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Upload(nil), s.uploads...)
+}
+
+// OpenedIMs lists the user ids im.open was called for
+func (s *Server) OpenedIMs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.ims...)
+}
+
+// IMChannel is the id of the IM channel im.open hands out for a user
+func IMChannel(userID string) string {
+	return "D" + userID
+}
+
+func (s *Server) wait(timeout time.Duration, done func() bool) error {
+	//Wake up any waiters once the timeout passes
+	timer := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for !done() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("fakeslack: timed out after %v", timeout)
+		}
+		s.cond.Wait()
+	}
+
+	return nil
+}
+
+func (s *Server) nextTimestamp() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ts++
+	return fmt.Sprintf("%d.%06d", time.Now().Unix(), s.ts)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	if method == "ws" {
+		s.handleWebsocket(w, r)
+		return
+	}
+
+	if method == "files.upload" {
+		s.handleUpload(w, r)
+		return
+	}
+
+	r.ParseForm()
+
+	switch method {
+	case "auth.test":
+		s.reply(w, map[string]interface{}{"user_id": BotID, "user": "slackcat", "team_id": "T1", "team": "fakeslack"})
+
+	case "rtm.connect", "rtm.start":
+		s.mu.Lock()
+		users := make([]user, 0, len(s.users))
+		for _, u := range s.users {
+			users = append(users, u)
+		}
+
+		channels := make([]channel, 0, len(s.channels))
+		for _, ch := range s.channels {
+			channels = append(channels, ch)
+		}
+		s.mu.Unlock()
+
+		s.reply(w, map[string]interface{}{
+			"url":      "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/ws",
+			"self":     user{BotID, "slackcat"},
+			"team":     map[string]string{"id": "T1", "name": "fakeslack", "domain": "fakeslack"},
+			"users":    users,
+			"channels": channels,
+		})
+
+	case "chat.postMessage":
+		ts := s.nextTimestamp()
+		s.record(func() {
+			s.posted = append(s.posted, PostedMessage{r.Form.Get("channel"), r.Form.Get("text")})
+		})
+		s.reply(w, map[string]interface{}{"channel": r.Form.Get("channel"), "ts": ts})
+
+	case "reactions.add":
+		s.record(func() {
+			s.reactions = append(s.reactions, Reaction{r.Form.Get("name"), r.Form.Get("channel"), r.Form.Get("timestamp")})
+		})
+		s.reply(w, nil)
+
+	case "users.info":
+		s.mu.Lock()
+		u, ok := s.users[r.Form.Get("user")]
+		s.mu.Unlock()
+
+		if !ok {
+			s.fail(w, "user_not_found")
+			return
+		}
+		s.reply(w, map[string]interface{}{"user": u})
+
+	case "users.list":
+		s.mu.Lock()
+		users := make([]user, 0, len(s.users))
+		for _, u := range s.users {
+			users = append(users, u)
+		}
+		s.mu.Unlock()
+
+		s.reply(w, map[string]interface{}{"members": users})
+
+	case "channels.info", "conversations.info":
+		s.mu.Lock()
+		ch, ok := s.channels[r.Form.Get("channel")]
+		s.mu.Unlock()
+
+		if !ok {
+			s.fail(w, "channel_not_found")
+			return
+		}
+		s.reply(w, map[string]interface{}{"channel": ch})
+
+	case "im.open":
+		id := r.Form.Get("user")
+		s.record(func() {
+			s.ims = append(s.ims, id)
+		})
+		s.reply(w, map[string]interface{}{
+			"no_op":        false,
+			"already_open": false,
+			"channel":      map[string]string{"id": IMChannel(id)},
+		})
+
+	default:
+		s.fail(w, "unknown_method")
+	}
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		s.fail(w, "invalid_form_data")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		s.fail(w, "no_file_data")
+		return
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		s.fail(w, "no_file_data")
+		return
+	}
+
+	s.record(func() {
+		s.uploads = append(s.uploads, Upload{r.FormValue("channels"), header.Filename, r.FormValue("title"), content})
+	})
+	s.reply(w, map[string]interface{}{"file": map[string]string{"id": fmt.Sprintf("F%d", len(s.Uploads())), "name": header.Filename}})
+}
+
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.connMu.Lock()
+	err = conn.WriteJSON(map[string]string{"type": "hello"})
+	s.connMu.Unlock()
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	s.record(func() {
+		s.conn = conn
+	})
+
+	for {
+		_, blob, err := conn.ReadMessage()
+		if err != nil {
+			s.record(func() {
+				if s.conn == conn {
+					s.conn = nil
+				}
+			})
+			return
+		}
+
+		var frame Frame
+		if json.Unmarshal(blob, &frame) != nil {
+			continue
+		}
+
+		if frame.Type == "ping" {
+			s.connMu.Lock()
+			conn.WriteJSON(map[string]interface{}{"type": "pong", "reply_to": frame.ID})
+			s.connMu.Unlock()
+			continue
+		}
+
+		s.record(func() {
+			s.frames = append(s.frames, frame)
+		})
+
+		//Acknowledge the message like slack does
+		s.connMu.Lock()
+		conn.WriteJSON(map[string]interface{}{"ok": true, "reply_to": frame.ID, "ts": s.nextTimestamp(), "text": frame.Text})
+		s.connMu.Unlock()
+	}
+}
+
+// Runs f while holding the lock then wakes up anything waiting on it
+func (s *Server) record(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f()
+	s.cond.Broadcast()
+}
+
+func (s *Server) reply(w http.ResponseWriter, fields map[string]interface{}) {
+	resp := map[string]interface{}{"ok": true}
+	for k, v := range fields {
+		resp[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) fail(w http.ResponseWriter, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": reason})
+}
+
+// NewServer starts a fake slack server on a random local port
+func NewServer() *Server {
+	s := &Server{
+		users:    make(map[string]user),
+		channels: make(map[string]channel),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+
+	s.cond = sync.NewCond(&s.mu)
+	s.AddUser(BotID, "slackcat")
+	s.srv = httptest.NewServer(s)
+
+	return s
+}
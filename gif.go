@@ -1,7 +1,7 @@
 package main
 
 import (
-	"github.com/nlopes/slack"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -10,19 +10,20 @@ import (
 )
 
 type GifCommand struct {
-	rtm    *slack.RTM
+	chat   ChatClient
+	prefix string
 	client *http.Client
 	match  *regexp.Regexp
 }
 
-func (c *GifCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return strings.HasPrefix(msg.Text, "?gif "), false
+func (c *GifCommand) Matches(msg *Message) bool {
+	return strings.HasPrefix(msg.Text, c.prefix+"gif ")
 }
 
-func (c *GifCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
+func (c *GifCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
 	txt := strings.SplitN(msg.Text, " ", 2)
 	q := url.QueryEscape(
-		strings.ToLower(parseUsernamesAndChannels(&c.rtm.Client, txt[1])),
+		strings.ToLower(parseUsernamesAndChannels(c.chat, txt[1])),
 	)
 
 	searchUrl := "https://www.google.com/search?source=lnms&tbm=isch&tbs=itp:animated,ift:gif&q=" + q
@@ -32,11 +33,12 @@ func (c *GifCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 		return nil, err
 	}
 
+	req = req.WithContext(ctx)
+
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_10_5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/46.0.2490.71 Safari/537.36")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		resp.Body.Close()
 		return nil, err
 	}
 
@@ -50,15 +52,15 @@ func (c *GifCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 	found := c.match.FindStringSubmatch(string(body[:]))
 
 	if found == nil {
-		out := c.rtm.NewOutgoingMessage("I got nothing for that.", msg.Channel)
+		out := NewOutgoingMessage("I got nothing for that.", msg.Channel)
 		return out, nil
 	}
 
-	return c.rtm.NewOutgoingMessage(found[1], msg.Channel), nil
+	return NewOutgoingMessage(found[1], msg.Channel), nil
 }
 
 func (c *GifCommand) GetSyntax() string {
-	return "?gif <search>"
+	return c.prefix + "gif <search>"
 }
 
 func (c *GifCommand) GetDescription() string {
@@ -68,9 +70,10 @@ func (c *GifCommand) GetDescription() string {
 func (c *GifCommand) Close() {
 }
 
-func NewGifCommand(rtm *slack.RTM) *GifCommand {
+func NewGifCommand(chat ChatClient, cfg CommandConfig) *GifCommand {
 	return &GifCommand{
-		rtm,
+		chat,
+		cfg.Prefix,
 		&http.Client{},
 		regexp.MustCompile(`"ou":"(.*?)"`),
 	}
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/nlopes/slack"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -29,33 +29,39 @@ type giphyResp struct {
 }
 
 type GiphyCommand struct {
-	rtm    *slack.RTM
+	chat   ChatClient
+	prefix string
 	cli    *http.Client
 	search *url.URL
 	key    string
 }
 
-func (c *GiphyCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return strings.HasPrefix(msg.Text, "?giphy "), false
+func (c *GiphyCommand) Matches(msg *Message) bool {
+	return strings.HasPrefix(msg.Text, c.prefix+"giphy ")
 }
 
-func (c *GiphyCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
+func (c *GiphyCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
 	txt := strings.SplitN(msg.Text, " ", 2)
 
 	if len(txt) < 2 {
 		return nil, fmt.Errorf("Invalid Syntax")
 	}
 
-	q := c.search.Query()
-	q.Set("api_key", "dc6zaTOxFJmzC")
+	//Copy the search url since commands can run concurrently
+	search := *c.search
+	q := search.Query()
+	q.Set("api_key", c.key)
 	q.Set("q", txt[1])
 	q.Set("limit", "100")
-	c.search.RawQuery = q.Encode()
+	search.RawQuery = q.Encode()
 
-	resp, err := c.cli.Get(c.search.String())
+	req, err := http.NewRequest("GET", search.String(), nil)
+	if err != nil {
+		return nil, err
+	}
 
+	resp, err := c.cli.Do(req.WithContext(ctx))
 	if err != nil {
-		resp.Body.Close()
 		return nil, err
 	}
 
@@ -65,24 +71,22 @@ func (c *GiphyCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
 	if err != nil {
-		resp.Body.Close()
 		return nil, err
 	}
 
 	var respObj giphyResp
 	err = json.Unmarshal(body, &respObj)
 	if err != nil {
-		resp.Body.Close()
 		return nil, err
 	}
 
 	if respObj.Meta.Status != 200 {
-		resp.Body.Close()
 		return nil, fmt.Errorf("Giphy error: %s", respObj.Meta.Error)
 	}
 
-	out := c.rtm.NewOutgoingMessage("Giphy don't know", msg.Channel)
+	out := NewOutgoingMessage("Giphy don't know", msg.Channel)
 	if len(respObj.Data) > 0 {
 		rand.Seed(time.Now().Unix())
 		randData := respObj.Data[rand.Intn(len(respObj.Data))]
@@ -93,18 +97,18 @@ func (c *GiphyCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 }
 
 func (c *GiphyCommand) GetSyntax() string {
-	return "?giphy <search>"
+	return c.prefix + "giphy <search>"
 }
 
 func (c *GiphyCommand) GetDescription() string {
-	return "Finds an image using giphy search. (It's better to use `?gif` instead)"
+	return "Finds an image using giphy search. (It's better to use `" + c.prefix + "gif` instead)"
 }
 
 func (c *GiphyCommand) Close() {
 
 }
 
-func NewGiphyCommand(rtm *slack.RTM) *GiphyCommand {
+func NewGiphyCommand(chat ChatClient, cfg GiphyConfig) *GiphyCommand {
 	search := &url.URL{
 		Scheme: "http",
 		Host:   "api.giphy.com",
@@ -112,9 +116,10 @@ func NewGiphyCommand(rtm *slack.RTM) *GiphyCommand {
 	}
 
 	return &GiphyCommand{
-		rtm,
+		chat,
+		cfg.Prefix,
 		&http.Client{},
 		search,
-		"dc6zaTOxFJmzC",
+		cfg.Key,
 	}
 }
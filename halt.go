@@ -1,27 +1,30 @@
 package main
 
 import (
-	"github.com/nlopes/slack"
+	"context"
 )
 
 type HaltCommand struct {
-	rtm *slack.RTM
+	chat   ChatClient
+	prefix string
 }
 
-func (c *HaltCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return msg.Text == "?halt", false
+func (c *HaltCommand) Matches(msg *Message) bool {
+	return msg.Text == c.prefix+"halt"
 }
 
-func (c *HaltCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
-	status := c.rtm.NewOutgoingMessage("Brb...", msg.Channel)
-	c.rtm.SendMessage(status)
-	c.rtm.Disconnect()
+func (c *HaltCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	status := NewOutgoingMessage("Brb...", msg.Channel)
+	err := sendMessage(ctx, c.chat, status)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	return nil, c.chat.Disconnect()
 }
 
 func (c *HaltCommand) GetSyntax() string {
-	return "?halt"
+	return c.prefix + "halt"
 }
 
 func (c *HaltCommand) GetDescription() string {
@@ -31,6 +34,6 @@ func (c *HaltCommand) GetDescription() string {
 func (c *HaltCommand) Close() {
 }
 
-func NewHaltCommand(rtm *slack.RTM) *HaltCommand {
-	return &HaltCommand{rtm}
+func NewHaltCommand(chat ChatClient, cfg CommandConfig) *HaltCommand {
+	return &HaltCommand{chat, cfg.Prefix}
 }
@@ -2,21 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"github.com/nlopes/slack"
 	"text/tabwriter"
 )
 
 type HelpCommand struct {
-	rtm  *slack.RTM
-	cmds []SlackCatCommand
+	chat   ChatClient
+	prefix string
+	cmds   []SlackCatCommand
 }
 
-func (c *HelpCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return msg.Text == "?help", false
+func (c *HelpCommand) Matches(msg *Message) bool {
+	return msg.Text == c.prefix+"help"
 }
 
-func (c *HelpCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
+func (c *HelpCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
 	buf := bytes.NewBufferString("Here are all my known commands...\n```")
 	w := tabwriter.NewWriter(buf, 4, 0, 1, ' ', tabwriter.AlignRight)
 	f := "%s\n\t%s\n\n"
@@ -31,11 +32,11 @@ func (c *HelpCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 	fmt.Fprint(w, "```")
 	w.Flush()
 
-	return c.rtm.NewOutgoingMessage(buf.String(), msg.Channel), nil
+	return NewOutgoingMessage(buf.String(), msg.Channel), nil
 }
 
 func (c *HelpCommand) GetSyntax() string {
-	return "?help"
+	return c.prefix + "help"
 }
 
 func (c *HelpCommand) GetDescription() string {
@@ -45,6 +46,6 @@ func (c *HelpCommand) GetDescription() string {
 func (c *HelpCommand) Close() {
 }
 
-func NewHelpCommand(rtm *slack.RTM, cmds []SlackCatCommand) *HelpCommand {
-	return &HelpCommand{rtm, cmds}
+func NewHelpCommand(chat ChatClient, cmds []SlackCatCommand, cfg CommandConfig) *HelpCommand {
+	return &HelpCommand{chat, cfg.Prefix, cmds}
 }
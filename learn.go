@@ -1,48 +1,60 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/nlopes/slack"
 	"regexp"
 	"strings"
 )
 
+// Index names are prefixed with the table since sqlite
+// index names share one namespace across every table.
+var learnMigrations = []Migration{
+	{1, "create learns", execMigration(
+		"CREATE TABLE IF NOT EXISTS learns (target TEXT NOT NULL, value TEXT NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS learns_target_idx ON learns (target)",
+		"CREATE INDEX IF NOT EXISTS learns_target_value_idx ON learns (target, value)",
+	)},
+}
+
 type LearnCommand struct {
-	rtm *slack.RTM
-	exp *regexp.Regexp
-	ins *sql.Stmt
-	del *sql.Stmt
-	sel *sql.Stmt
+	chat   ChatClient
+	prefix string
+	exp    *regexp.Regexp
+	recall *regexp.Regexp
+	ins    *sql.Stmt
+	del    *sql.Stmt
+	sel    *sql.Stmt
 }
 
-func (c *LearnCommand) Matches(msg *slack.Msg) (bool, bool) {
+func (c *LearnCommand) Matches(msg *Message) bool {
 	if c.exp.MatchString(msg.Text) {
-		return true, false
+		return true
 	}
 
 	txt := strings.SplitN(msg.Text, " ", 2)
-	if len(txt) < 1 || len(txt[0]) < 1 || txt[0][0] != '?' {
-		return false, false
+	if len(txt) < 1 || len(txt[0]) <= len(c.prefix) || !strings.HasPrefix(txt[0], c.prefix) {
+		return false
 	}
 
 	token := c.parseTarget(
-		strings.ToLower(txt[0][1:]),
+		strings.ToLower(txt[0][len(c.prefix):]),
 	)
 
 	var val string
 	err := c.sel.QueryRow(token).Scan(&val)
 
-	return err == nil, false
+	return err == nil
 }
 
-func (c *LearnCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
+func (c *LearnCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
 	if c.exp.MatchString(msg.Text) {
 		vars := c.exp.FindStringSubmatch(msg.Text)
 		dbCmd := c.ins
 		target := c.parseTarget(vars[2])
 
-		out := c.rtm.NewOutgoingMessage(fmt.Sprintf("OK, learned %s", target), msg.Channel)
+		out := NewOutgoingMessage(fmt.Sprintf("OK, learned %s", target), msg.Channel)
 		if vars[1] == "unlearn" {
 			dbCmd = c.del
 			out.Text = fmt.Sprintf("Unlearned %s", target)
@@ -54,26 +66,26 @@ func (c *LearnCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 
 	txt := strings.SplitN(msg.Text, " ", 2)
 	token := c.parseTarget(
-		strings.ToLower(txt[0][1:]),
+		strings.ToLower(txt[0][len(c.prefix):]),
 	)
 
 	var val string
 	err := c.sel.QueryRow(token).Scan(&val)
 	if err != nil {
-		fmt.Printf("error searching db: %v\n", err)
+		logger.WithError(err).Error("error searching db")
 		return nil, nil
 	}
 
-	out := c.rtm.NewOutgoingMessage(c.parseText(val), msg.Channel)
+	out := NewOutgoingMessage(c.parseText(val), msg.Channel)
 	return out, nil
 }
 
 func (c *LearnCommand) GetSyntax() string {
-	return "?(un)learn <target> <value>"
+	return c.prefix + "(un)learn <target> <value>"
 }
 
 func (c *LearnCommand) GetDescription() string {
-	return "Make slack cat associate two things. These associations can be randomly displayed by typing `?<target>`"
+	return "Make slack cat associate two things. These associations can be randomly displayed by typing `" + c.prefix + "<target>`"
 }
 
 func (c *LearnCommand) Close() {
@@ -87,13 +99,13 @@ func (c *LearnCommand) parseTarget(txt string) string {
 	chanReg := regexp.MustCompile("^<#(\\w+)\\|?(\\w*)>$")
 	if userReg.MatchString(txt) {
 		vars := userReg.FindStringSubmatch(txt)
-		user, err := c.rtm.GetUserInfo(vars[1])
+		user, err := c.chat.GetUserInfo(vars[1])
 		if err == nil {
 			txt = user.Name
 		}
 	} else if chanReg.MatchString(txt) {
 		vars := chanReg.FindStringSubmatch(txt)
-		ch, err := c.rtm.GetChannelInfo(vars[1])
+		ch, err := c.chat.GetChannelInfo(vars[1])
 		if err == nil {
 			txt = ch.Name
 		}
@@ -103,8 +115,7 @@ func (c *LearnCommand) parseTarget(txt string) string {
 }
 
 func (c *LearnCommand) parseText(txt string) string {
-	re := regexp.MustCompile("\\?([^\\s]+)")
-	vars := re.FindAllStringSubmatch(txt, -1)
+	vars := c.recall.FindAllStringSubmatch(txt, -1)
 
 	for _, v := range vars {
 		var val string
@@ -119,30 +130,28 @@ func (c *LearnCommand) parseText(txt string) string {
 	return txt
 }
 
-func NewLearnCommand(rtm *slack.RTM, db *sql.DB) *LearnCommand {
-	exp := regexp.MustCompile(`^(?i)\?(learn|unlearn) ([\w@<>\|#]+) (.+?)$`)
-
-	db.Exec("CREATE TABLE learns (target TEXT NOT NULL, value TEXT NOT NULL)")
-	db.Exec("CREATE INDEX target_idx IF NOT EXISTS ON learns (target)")
-	db.Exec("CREATE INDEX target_value_idx IF NOT EXISTS ON learns (target, value)")
+func NewLearnCommand(chat ChatClient, db *sql.DB, cfg CommandConfig) *LearnCommand {
+	prefix := regexp.QuoteMeta(cfg.Prefix)
+	exp := regexp.MustCompile(`^(?i)` + prefix + `(learn|unlearn) ([\w@<>\|#]+) (.+?)$`)
+	recall := regexp.MustCompile(prefix + `([^\s]+)`)
 
 	ins, err := db.Prepare("INSERT INTO learns(target, value) VALUES(?,?)")
 	if err != nil {
-		fmt.Printf("error preparing learn insert: %v\n", err)
+		logger.WithError(err).Error("error preparing learn insert")
 		return nil
 	}
 
 	del, err := db.Prepare("DELETE from learns WHERE target=? AND value=?")
 	if err != nil {
-		fmt.Printf("error preparing learn delete: %v\n", err)
+		logger.WithError(err).Error("error preparing learn delete")
 		return nil
 	}
 
 	sel, err := db.Prepare("SELECT value FROM learns WHERE target=? ORDER BY RANDOM() LIMIT 1")
 	if err != nil {
-		fmt.Printf("error preparing learn select: %v\n", err)
+		logger.WithError(err).Error("error preparing learn select")
 		return nil
 	}
 
-	return &LearnCommand{rtm, exp, ins, del, sel}
+	return &LearnCommand{chat, cfg.Prefix, exp, recall, ins, del, sel}
 }
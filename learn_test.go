@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestLearnCommand(t *testing.T) {
+	bot := newTestBot(t, nil)
+
+	bot.expect(testAliceID, "?learn cat meow", "OK, learned cat")
+	bot.expect(testBobID, "?cat", "meow")
+	bot.expect(testBobID, "?CAT", "meow")
+
+	bot.expect(testAliceID, "?learn dog woof ?cat", "OK, learned dog")
+	bot.expect(testBobID, "?dog", "woof meow")
+
+	bot.expect(testAliceID, "?learn <@UBOB> likes cheese", "OK, learned bob")
+	bot.expect(testAliceID, "?bob", "likes cheese")
+
+	bot.expect(testAliceID, "?unlearn cat meow", "Unlearned cat")
+	replies := bot.say(testBobID, "?cat")
+	if len(replies) != 0 {
+		t.Errorf("expected nothing for an unlearned target, got %q", replies)
+	}
+}
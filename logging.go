@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+)
+
+// logger writes structured json log lines. Anything that wants to log
+// should add fields (command, user, channel, ...) rather than formatting
+// them into the message so the logs stay searchable.
+var logger = &logrus.Logger{
+	Out:       os.Stdout,
+	Formatter: &logrus.JSONFormatter{},
+	Hooks:     make(logrus.LevelHooks),
+	Level:     logrus.InfoLevel,
+}
+
+// Fields for logging something about a message
+func messageFields(msg *Message) logrus.Fields {
+	return logrus.Fields{
+		"user":    msg.User,
+		"channel": msg.Channel,
+	}
+}
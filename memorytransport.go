@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+type MemoryReaction struct {
+	Emoji     string
+	Channel   string
+	Timestamp string
+}
+
+type MemoryUpload struct {
+	Channel  string
+	Filename string
+	Title    string
+	Content  []byte
+}
+
+// MemoryTransport is a ChatClient that keeps everything in memory.
+// Messages and reactions are recorded rather than sent anywhere,
+// which makes it handy for exercising commands without slack.
+type MemoryTransport struct {
+	mu           sync.Mutex
+	Users        map[string]*ChatUser
+	Channels     map[string]*ChatChannel
+	Sent         []*OutgoingMessage
+	Reactions    []MemoryReaction
+	Uploads      []MemoryUpload
+	Disconnected bool
+}
+
+func (t *MemoryTransport) SendMessage(msg *OutgoingMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Sent = append(t.Sent, msg)
+	return nil
+}
+
+func (t *MemoryTransport) AddReaction(emoji string, channel string, timestamp string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Reactions = append(t.Reactions, MemoryReaction{emoji, channel, timestamp})
+	return nil
+}
+
+func (t *MemoryTransport) UploadFile(channel string, filename string, title string, r io.Reader) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Uploads = append(t.Uploads, MemoryUpload{channel, filename, title, content})
+	return nil
+}
+
+func (t *MemoryTransport) GetUserInfo(id string) (*ChatUser, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	user, ok := t.Users[id]
+	if !ok {
+		return nil, fmt.Errorf("user_not_found")
+	}
+
+	return user, nil
+}
+
+func (t *MemoryTransport) ListUsers() ([]ChatUser, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	users := make([]ChatUser, 0, len(t.Users))
+	for _, user := range t.Users {
+		users = append(users, *user)
+	}
+
+	return users, nil
+}
+
+func (t *MemoryTransport) GetChannelInfo(id string) (*ChatChannel, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch, ok := t.Channels[id]
+	if !ok {
+		return nil, fmt.Errorf("channel_not_found")
+	}
+
+	return ch, nil
+}
+
+func (t *MemoryTransport) Disconnect() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Disconnected = true
+	return nil
+}
+
+func (t *MemoryTransport) IsDisconnected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.Disconnected
+}
+
+func (t *MemoryTransport) AddUser(id string, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Users[id] = &ChatUser{id, name}
+}
+
+func (t *MemoryTransport) AddChannel(id string, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Channels[id] = &ChatChannel{id, name}
+}
+
+// Flush returns and clears everything recorded since the last flush
+func (t *MemoryTransport) Flush() ([]*OutgoingMessage, []MemoryReaction, []MemoryUpload) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sent, reactions, uploads := t.Sent, t.Reactions, t.Uploads
+	t.Sent, t.Reactions, t.Uploads = nil, nil, nil
+	return sent, reactions, uploads
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		Users:    make(map[string]*ChatUser),
+		Channels: make(map[string]*ChatChannel),
+	}
+}
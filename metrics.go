@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	commandInvocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "slackcat_command_invocations_total",
+		Help: "Number of times each command has been run.",
+	}, []string{"command"})
+
+	commandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "slackcat_command_errors_total",
+		Help: "Number of times each command has failed, timed out or panicked.",
+	}, []string{"command"})
+
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "slackcat_command_duration_seconds",
+		Help:    "How long each command took to run.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command"})
+
+	callbackDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "slackcat_callback_deliveries_total",
+		Help: "Webhook deliveries to each callback by response status code.",
+	}, []string{"callback", "status"})
+
+	rtmReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "slackcat_rtm_reconnects_total",
+		Help: "Number of times the slack RTM connection had to be re-established.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "slackcat_db_query_duration_seconds",
+		Help:    "Latency of database statements.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"op"})
+)
+
+// Name of the sqlite driver that records query latency
+const instrumentedSqlite = "sqlite3-instrumented"
+
+func init() {
+	sql.Register(instrumentedSqlite, &instrumentedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// The instrumented driver wraps the sqlite driver so that every statement
+// run through database/sql shows up in the db query latency histogram.
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedConn{conn}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	defer observeQuery("prepare", time.Now())
+
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedStmt{stmt}, nil
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	defer observeQuery("exec", time.Now())
+	return s.Stmt.Exec(args)
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	defer observeQuery("query", time.Now())
+	return s.Stmt.Query(args)
+}
+
+func observeQuery(op string, start time.Time) {
+	dbQueryDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Migration is a single versioned change to the database schema.
+// Versions only need to be unique and increasing within a component.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// MigrationSet groups the migrations owned by one command or callback.
+type MigrationSet struct {
+	Component  string
+	Migrations []Migration
+}
+
+// Every component that stores anything in the database registers
+// its migrations here. Sets are applied in this order.
+var schemaMigrations = []MigrationSet{
+	{"plus_denomination", plusDenominationMigrations},
+	{"plus", plusMigrations},
+	{"plus_shop", plusShopMigrations},
+	{"learn", learnMigrations},
+	{"react", reactMigrations},
+}
+
+// Migrations that need to look things up in chat, like mapping old
+// names to user ids. They run once the bot has connected so chat can
+// be nil when only their status is needed.
+func chatMigrations(chat ChatClient) []MigrationSet {
+	return []MigrationSet{
+		{"plus_users", plusUserMigrations(chat)},
+	}
+}
+
+// Builds a migration Up func that runs each statement in order
+func execMigration(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			_, err := tx.Exec(stmt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+type Migrator struct {
+	db   *sql.DB
+	sets []MigrationSet
+}
+
+type migrationStatus struct {
+	component string
+	migration Migration
+	applied   *time.Time
+}
+
+// Up applies every pending migration, each in its own transaction.
+func (m *Migrator) Up() error {
+	err := m.init()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := m.status()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		if s.applied != nil {
+			continue
+		}
+
+		err = m.apply(s.component, s.migration)
+		if err != nil {
+			return fmt.Errorf("migration %s/%d (%s) failed: %v", s.component, s.migration.Version, s.migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Status writes a table of every known migration and when it was applied.
+func (m *Migrator) Status(out io.Writer) error {
+	err := m.init()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := m.status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tVERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.applied != nil {
+			applied = s.applied.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", s.component, s.migration.Version, s.migration.Name, applied)
+	}
+
+	return w.Flush()
+}
+
+func (m *Migrator) init() error {
+	for _, set := range m.sets {
+		last := 0
+		for _, mig := range set.Migrations {
+			if mig.Version <= last {
+				return fmt.Errorf("migrations for %s are out of order at version %d", set.Component, mig.Version)
+			}
+			last = mig.Version
+		}
+	}
+
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		component TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		applied_at INTEGER NOT NULL,
+		PRIMARY KEY (component, version)
+	)`)
+
+	return err
+}
+
+func (m *Migrator) status() ([]migrationStatus, error) {
+	rows, err := m.db.Query("SELECT component, version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]map[int]time.Time)
+	for rows.Next() {
+		var component string
+		var version int
+		var at int64
+		err = rows.Scan(&component, &version, &at)
+		if err != nil {
+			return nil, err
+		}
+
+		if applied[component] == nil {
+			applied[component] = make(map[int]time.Time)
+		}
+		applied[component][version] = time.Unix(at, 0)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var statuses []migrationStatus
+	for _, set := range m.sets {
+		for _, mig := range set.Migrations {
+			s := migrationStatus{component: set.Component, migration: mig}
+			if at, ok := applied[set.Component][mig.Version]; ok {
+				s.applied = &at
+			}
+
+			statuses = append(statuses, s)
+		}
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) apply(component string, mig Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = mig.Up(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO schema_migrations(component, version, name, applied_at) VALUES(?,?,?,?)",
+		component, mig.Version, mig.Name, time.Now().Unix(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func NewMigrator(db *sql.DB, sets []MigrationSet) *Migrator {
+	return &Migrator{db, sets}
+}
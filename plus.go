@@ -2,77 +2,535 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/nlopes/slack"
 	"regexp"
-	"sort"
 	"strings"
 )
 
+var plusMigrations = []Migration{
+	{1, "create pluses", execMigration(
+		"CREATE TABLE IF NOT EXISTS pluses (target TEXT PRIMARY KEY NOT NULL, count INTEGER)",
+	)},
+	{2, "index plus counts", execMigration(
+		"CREATE INDEX IF NOT EXISTS pluses_count_idx ON pluses (count)",
+	)},
+	{3, "create plus ledger", execMigration(
+		"CREATE TABLE IF NOT EXISTS plus_ledger (id INTEGER PRIMARY KEY AUTOINCREMENT, giver TEXT NOT NULL, target TEXT NOT NULL, delta INTEGER NOT NULL, channel TEXT NOT NULL, timestamp TEXT NOT NULL, reason TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)",
+		"CREATE INDEX IF NOT EXISTS plus_ledger_target_idx ON plus_ledger (target)",
+		//Counts from before the ledger existed carry over as an opening balance
+		"INSERT INTO plus_ledger (giver, target, delta, channel, timestamp, reason) SELECT '', target, count, '', '', '' FROM pluses WHERE count != 0",
+	)},
+	{4, "index plus ledger givers", execMigration(
+		"CREATE INDEX IF NOT EXISTS plus_ledger_giver_target_idx ON plus_ledger (giver, target)",
+		"CREATE INDEX IF NOT EXISTS plus_ledger_giver_created_idx ON plus_ledger (giver, created_at)",
+	)},
+	{5, "create plus aliases", execMigration(
+		"CREATE TABLE IF NOT EXISTS plus_aliases (alias TEXT PRIMARY KEY NOT NULL, target TEXT NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS plus_aliases_target_idx ON plus_aliases (target)",
+	)},
+	{6, "create plus seasons", execMigration(
+		"CREATE TABLE IF NOT EXISTS plus_seasons (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE COLLATE NOCASE, started_at DATETIME NOT NULL, ended_at DATETIME NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS plus_season_standings (season INTEGER NOT NULL, target TEXT NOT NULL, count INTEGER NOT NULL, PRIMARY KEY (season, target))",
+	)},
+	{7, "create plus transfers", execMigration(
+		//An empty sender is a mint
+		"CREATE TABLE IF NOT EXISTS plus_transfers (id INTEGER PRIMARY KEY AUTOINCREMENT, sender TEXT NOT NULL, recipient TEXT NOT NULL, amount INTEGER NOT NULL, issuer TEXT NOT NULL, channel TEXT NOT NULL, timestamp TEXT NOT NULL, reason TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)",
+		"CREATE INDEX IF NOT EXISTS plus_transfers_sender_idx ON plus_transfers (sender)",
+		"CREATE INDEX IF NOT EXISTS plus_transfers_recipient_idx ON plus_transfers (recipient)",
+		"ALTER TABLE plus_ledger ADD COLUMN transfer INTEGER REFERENCES plus_transfers (id)",
+	)},
+	{8, "create plus balances", execMigration(
+		"CREATE TABLE IF NOT EXISTS plus_balances (target TEXT PRIMARY KEY NOT NULL, balance INTEGER NOT NULL)",
+		//Balances used to be the whole ledger, transfers included
+		"INSERT INTO plus_balances (target, balance) SELECT target, SUM(delta) FROM plus_ledger GROUP BY target HAVING SUM(delta) != 0",
+		//Transfers no longer count towards standings, so take this season's back out of them
+		`UPDATE pluses SET count = count - (SELECT COALESCE(SUM(delta), 0) FROM plus_ledger
+			WHERE transfer IS NOT NULL AND target = pluses.target
+			AND created_at >= COALESCE((SELECT MAX(ended_at) FROM plus_seasons), ''))`,
+		//plus_transfers has the same history, the ledger's transfer column is no longer used
+		"DELETE FROM plus_ledger WHERE transfer IS NOT NULL",
+	)},
+}
+
+// Pluses for users used to be stored under their lowercased name. This
+// moves any that match a current slack user over to their id.
+func plusUserMigrations(chat ChatClient) []Migration {
+	return []Migration{
+		{1, "key user pluses by id", func(tx *sql.Tx) error {
+			users, err := chat.ListUsers()
+			if err != nil {
+				return err
+			}
+
+			for _, user := range users {
+				err = mergePlusTargets(tx, strings.ToLower(user.Name), userTarget(user.ID))
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}},
+	}
+}
+
+// Moves the count, ledger history, balance, transfers, purchases, past seasons and aliases
+// of the from target over to the into target.
+func mergePlusTargets(tx *sql.Tx, from string, into string) error {
+	_, err := tx.Exec("INSERT INTO pluses(target, count) SELECT ?, count FROM pluses WHERE target=? ON CONFLICT(target) DO UPDATE SET count = count + excluded.count", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM pluses WHERE target=?", from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE plus_ledger SET target=? WHERE target=?", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO plus_season_standings(season, target, count) SELECT season, ?, count FROM plus_season_standings WHERE target=? ON CONFLICT(season, target) DO UPDATE SET count = count + excluded.count", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM plus_season_standings WHERE target=?", from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE plus_transfers SET sender=? WHERE sender=?", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE plus_transfers SET recipient=? WHERE recipient=?", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO plus_balances(target, balance) SELECT ?, balance FROM plus_balances WHERE target=? ON CONFLICT(target) DO UPDATE SET balance = balance + excluded.balance", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM plus_balances WHERE target=?", from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE plus_shop_purchases SET buyer=? WHERE buyer=?", into, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE plus_aliases SET target=? WHERE target=?", into, from)
+	return err
+}
+
+// PlusCommand records every plus and minus in the plus_ledger table.
+// The count kept in pluses is adjusted by the same amount in the same
+// transaction so the two can't drift apart. Counts are reset when a
+// season ends, so they only cover the ledger since then.
+//
+// Balances in plus_balances are what people can spend with the wallet
+// on. Only transfers change them and they carry on across seasons.
 type PlusCommand struct {
-	rtm      *slack.RTM
+	chat     ChatClient
+	prefix   string
 	exp      *regexp.Regexp
-	ins      *sql.Stmt
-	upd      *sql.Stmt
-	sel      *sql.Stmt
-	selDenom *sql.Stmt
+	db       *sql.DB
+	upsert   *sql.Stmt
+	ledger   *sql.Stmt
+	denoms   *PlusDenominations
+	selAlias *sql.Stmt
+	limits   *PlusLimiter
+	//Inline karma
+	inline    bool
+	inlineExp *regexp.Regexp
+	selKnown  *sql.Stmt
+	//Reactions
+	emoji      string
+	thread     bool
+	selReacted *sql.Stmt
+	//Transfers
+	insTransfer *sql.Stmt
+	selBalance  *sql.Stmt
+	addBalance  *sql.Stmt
+	//Whether pluses are spent from balances rather than counts
+	wallet bool
+	users  *PlusUsers
+}
+
+var (
+	userTargetExp = regexp.MustCompile(`^<@(\w+)(?:\|[^>]*)?>$`)
+	chanTargetExp = regexp.MustCompile(`^<#(\w+)\|?(\w*)>$`)
+)
+
+func userTarget(id string) string {
+	return "<@" + id + ">"
 }
 
-func (c *PlusCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return c.exp.MatchString(msg.Text), false
+// Matches `code` and ```code blocks```
+var codeExp = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+
+func (c *PlusCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
 }
 
-func (c *PlusCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
+func (c *PlusCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
 	vars := c.exp.FindStringSubmatch(msg.Text)
-	owner, err := c.rtm.GetUserInfo(msg.User)
+	owner, err := c.chat.GetUserInfo(msg.User)
 	if err != nil {
 		return nil, err
 	}
 
 	target := c.parseTarget(vars[2])
+	reason := strings.TrimSpace(strings.TrimLeft(vars[3], " ,:;-"))
+	add := (vars[1] == "++")
 
-	var val int
-	err = c.sel.QueryRow(target).Scan(&val)
+	delta := -1
+	if add {
+		if target == userTarget(msg.User) {
+			out := NewOutgoingMessage("You'll go blind that way.", msg.Channel)
+			return out, nil
+		}
+		delta = 1
+	}
+
+	val, err := c.record(ctx, msg, target, delta, reason)
+	if refusal, ok := err.(plusRefusal); ok {
+		out := NewOutgoingMessage(refusal.Error(), msg.Channel)
+		return out, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	out := NewOutgoingMessage(c.getMessage(msg.Channel, add, vars[2], owner.Name, val, reason), msg.Channel)
+	return out, nil
+}
+
+// Listen picks up inline karma like "thanks alice++ and bob--" anywhere
+// in a message. Every change is applied in one transaction and
+// answered with a single reply.
+func (c *PlusCommand) Listen(ctx context.Context, msg *Message) error {
+	//Bots repeat things, like a learned "thanks alice++", that
+	//shouldn't count as anyone giving a plus
+	if !c.inline || msg.Bot {
+		return nil
+	}
+
+	//Code is full of i++ so leave anything quoted alone
+	txt := codeExp.ReplaceAllString(msg.Text, " ")
+
+	var targets []string
+	var adds, explicit []bool
+	for _, idx := range c.inlineExp.FindAllStringSubmatchIndex(txt, -1) {
+		//Only count it if the ++ or -- ends a word, so "a++b" or "i++;" don't
+		end := " \t\n,.!?:"
+		if txt[idx[4]:idx[5]] == "--" {
+			//People write dashes like "well-- I", so a minus has to stand on its own
+			end = " \t\n"
+		}
+
+		if idx[1] < len(txt) && !strings.ContainsRune(end, rune(txt[idx[1]])) {
+			continue
+		}
+
+		//"@build-server--" or a mention can't be a stray dash
+		name := txt[idx[2]:idx[3]]
+		explicit = append(explicit, strings.HasPrefix(name, "@") || strings.HasPrefix(name, "<"))
+		targets = append(targets, strings.TrimPrefix(name, "@"))
+		adds = append(adds, txt[idx[4]:idx[5]] == "++")
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	owner, err := c.chat.GetUserInfo(msg.User)
 	if err != nil {
-		fmt.Printf("error searching db: %v\n", err)
-		c.ins.Exec(target, 0)
-		val = 0
+		return err
 	}
 
-	add := (vars[1] == "++")
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lines []string
+	seen := make(map[string]bool)
+	for i, name := range targets {
+		target := c.parseTarget(name)
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		//"well-- I" still looks like a minus, so unless it was written
+		//as one only take them from people and things that are known
+		if !adds[i] && !explicit[i] {
+			known, err := c.isKnownTarget(tx, target)
+			if err != nil {
+				return err
+			} else if !known {
+				continue
+			}
+		}
 
-	if add {
-		val += 1
-		if target == owner.Name {
-			out := c.rtm.NewOutgoingMessage("You'll go blind that way.", msg.Channel)
-			return out, nil
+		delta := -1
+		if adds[i] {
+			if target == userTarget(msg.User) {
+				lines = append(lines, "You'll go blind that way.")
+				continue
+			}
+			delta = 1
+		}
+
+		val, err := c.apply(tx, msg, target, delta, "")
+		if refusal, ok := err.(plusRefusal); ok {
+			lines = append(lines, refusal.Error())
+			continue
+		} else if err != nil {
+			return err
 		}
+
+		lines = append(lines, c.getChangeMessage(adds[i], name, owner.Name, val, ""))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return sendMessage(ctx, c.chat, NewOutgoingMessage(strings.Join(lines, "\n"), msg.Channel))
+}
+
+// A target is known if it's a person, or it has ever been given or
+// lost a plus. The ledger is checked rather than counts so targets stay
+// known after a season ends.
+func (c *PlusCommand) isKnownTarget(tx *sql.Tx, target string) (bool, error) {
+	if userTargetExp.MatchString(target) {
+		return true, nil
+	}
+
+	var known int
+	err := tx.Stmt(c.selKnown).QueryRow(target).Scan(&known)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// React gives the author of a message a plus when someone reacts to it
+// with the plus emoji, and takes it back when the reaction is removed.
+func (c *PlusCommand) React(ctx context.Context, r *Reaction) error {
+	if c.emoji == "" || r.Emoji != c.emoji || r.ItemUser == "" {
+		return nil
+	}
+
+	if r.User == r.ItemUser {
+		if r.Removed {
+			return nil
+		}
+		return c.replyToReaction(ctx, r, "You'll go blind that way.")
+	}
+
+	//Ledger entries for reactions point at the message that was reacted to
+	msg := &Message{User: r.User, Channel: r.Channel, Timestamp: r.Timestamp}
+	target := c.parseTarget(userTarget(r.ItemUser))
+	reason := fmt.Sprintf("reacted with :%s:", c.emoji)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//Only one plus per reaction and only take back what was actually given
+	var given int
+	err = tx.Stmt(c.selReacted).QueryRow(r.User, target, r.Channel, r.Timestamp).Scan(&given)
+	if err != nil {
+		return err
+	}
+
+	if (r.Removed && given <= 0) || (!r.Removed && given > 0) {
+		return nil
+	}
+
+	var val int
+	if r.Removed {
+		val, err = c.write(tx, msg, target, -1, reason)
 	} else {
-		val -= 1
+		val, err = c.apply(tx, msg, target, 1, reason)
+	}
+
+	if refusal, ok := err.(plusRefusal); ok {
+		return c.replyToReaction(ctx, r, refusal.Error())
+	} else if err != nil {
+		return err
 	}
 
-	_, err = c.upd.Exec(val, target)
+	err = tx.Commit()
 	if err != nil {
-		fmt.Printf("error updating db: %v\n", err)
+		return err
 	}
 
-	out := c.rtm.NewOutgoingMessage(c.getMessage(add, vars[2], owner.Name, val), msg.Channel)
-	return out, err
+	giver, err := c.chat.GetUserInfo(r.User)
+	if err != nil {
+		return err
+	}
+
+	return c.replyToReaction(ctx, r, c.getMessage(r.Channel, !r.Removed, c.targetName(target), giver.Name, val, ""))
 }
 
-func (c *PlusCommand) parseTarget(txt string) string {
-	userReg := regexp.MustCompile(`^<@(\w+)>$`)
-	chanReg := regexp.MustCompile(`^<#(\w+)\|?(\w*)>$`)
-	if userReg.MatchString(txt) {
-		vars := userReg.FindStringSubmatch(txt)
-		user, err := c.rtm.GetUserInfo(vars[1])
-		if err == nil {
-			txt = user.Name
+func (c *PlusCommand) replyToReaction(ctx context.Context, r *Reaction, txt string) error {
+	out := NewOutgoingMessage(txt, r.Channel)
+	if c.thread {
+		out.ThreadTimestamp = r.Timestamp
+	}
+
+	return sendMessage(ctx, c.chat, out)
+}
+
+// Adds a ledger entry for target and returns its new count. A
+// plusRefusal is returned if the giver has hit one of the limits.
+func (c *PlusCommand) record(ctx context.Context, msg *Message, target string, delta int, reason string) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	val, err := c.apply(tx, msg, target, delta, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	return val, tx.Commit()
+}
+
+// Same as record but as part of an existing transaction
+func (c *PlusCommand) apply(tx *sql.Tx, msg *Message, target string, delta int, reason string) (int, error) {
+	err := c.limits.Check(tx, msg.User, target, c.targetName(target), delta)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.write(tx, msg, target, delta, reason)
+}
+
+// Same as apply without checking the limits
+func (c *PlusCommand) write(tx *sql.Tx, msg *Message, target string, delta int, reason string) (int, error) {
+	_, err := tx.Stmt(c.ledger).Exec(msg.User, target, delta, msg.Channel, msg.Timestamp, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	var val int
+	err = tx.Stmt(c.upsert).QueryRow(target, delta).Scan(&val)
+	return val, err
+}
+
+// Records amount moving from sender to recipient in plus_transfers and
+// moves it between their balances. An empty sender mints the pluses and
+// an empty recipient spends them. Counts and the ledger are left alone
+// so transfers don't change anyone's standing. Returns a plusRefusal if
+// the sender can't afford it, otherwise the new balances of sender and
+// recipient.
+func (c *PlusCommand) transfer(tx *sql.Tx, msg *Message, sender string, recipient string, amount int, reason string) (int, int, error) {
+	if sender != "" {
+		bal, err := c.balance(tx, sender)
+		if err != nil {
+			return 0, 0, err
 		}
-	} else if chanReg.MatchString(txt) {
-		vars := chanReg.FindStringSubmatch(txt)
-		ch, err := c.rtm.GetChannelInfo(vars[1])
+
+		if bal < amount {
+			return 0, 0, plusRefusal(fmt.Sprintf("You only have %s.", c.pluralize(bal, "plus")))
+		}
+	}
+
+	_, err := tx.Stmt(c.insTransfer).Exec(sender, recipient, amount, msg.User, msg.Channel, msg.Timestamp, reason)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, received := 0, 0
+	if sender != "" {
+		sent, err = c.adjustBalance(tx, sender, -amount)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if recipient != "" {
+		received, err = c.adjustBalance(tx, recipient, amount)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return sent, received, nil
+}
+
+func (c *PlusCommand) balance(tx *sql.Tx, target string) (int, error) {
+	var bal int
+	err := tx.Stmt(c.selBalance).QueryRow(target).Scan(&bal)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return bal, err
+}
+
+// Adds delta to target's balance and returns the new balance
+func (c *PlusCommand) adjustBalance(tx *sql.Tx, target string, delta int) (int, error) {
+	var bal int
+	err := tx.Stmt(c.addBalance).QueryRow(target, delta).Scan(&bal)
+	return bal, err
+}
+
+// Works out which target txt refers to, following any alias
+func (c *PlusCommand) parseTarget(txt string) string {
+	target := c.normalizeTarget(txt)
+
+	var canonical string
+	err := c.selAlias.QueryRow(target).Scan(&canonical)
+	if err == sql.ErrNoRows {
+		return target
+	} else if err != nil {
+		logger.WithError(err).Error("error looking up plus alias")
+		return target
+	}
+
+	return canonical
+}
+
+// Slack users are stored as a mention of their id, so pluses stick with
+// them through renames. That includes people given by their plain name.
+// Channels and anything else are stored as text.
+func (c *PlusCommand) normalizeTarget(txt string) string {
+	if vars := userTargetExp.FindStringSubmatch(txt); vars != nil {
+		return userTarget(vars[1])
+	}
+
+	if id, ok := c.users.ID(strings.TrimPrefix(txt, "@")); ok {
+		return userTarget(id)
+	}
+
+	if vars := chanTargetExp.FindStringSubmatch(txt); vars != nil {
+		ch, err := c.chat.GetChannelInfo(vars[1])
 		if err == nil {
 			txt = ch.Name
 		}
@@ -81,16 +539,25 @@ func (c *PlusCommand) parseTarget(txt string) string {
 	return strings.ToLower(txt)
 }
 
-func (c *PlusCommand) getMessage(add bool, target string, user string, val int) string {
-	buf := bytes.NewBufferString("")
-	if add {
-		buf.WriteString(fmt.Sprintf("%s gave a plus to %s, ", user, target))
-	} else {
-		buf.WriteString(fmt.Sprintf("%s took a plus from %s, ", user, target))
+// Turns a stored target back into something readable, looking up the
+// current name for users.
+func (c *PlusCommand) targetName(target string) string {
+	vars := userTargetExp.FindStringSubmatch(target)
+	if vars == nil {
+		return target
 	}
 
-	buf.WriteString(fmt.Sprintf("%s now has %s.", target, c.pluralize(val, "plus")))
-	denom := c.denominationEquivalent(val)
+	name, ok := c.users.Name(vars[1])
+	if !ok {
+		return vars[1]
+	}
+
+	return name
+}
+
+func (c *PlusCommand) getMessage(channel string, add bool, target string, user string, val int, reason string) string {
+	buf := bytes.NewBufferString(c.getChangeMessage(add, target, user, val, reason))
+	denom := c.denominationEquivalent(channel, val)
 	if denom != "" {
 		buf.WriteString(fmt.Sprintf("\n\nThat's equivalent to %s", denom))
 	}
@@ -98,89 +565,65 @@ func (c *PlusCommand) getMessage(add bool, target string, user string, val int)
 	return buf.String()
 }
 
-func (c *PlusCommand) denominationEquivalent(val int) string {
+func (c *PlusCommand) getChangeMessage(add bool, target string, user string, val int, reason string) string {
 	buf := bytes.NewBufferString("")
-	if c.selDenom == nil {
-		return ""
+	if add {
+		buf.WriteString(fmt.Sprintf("%s gave a plus to %s", user, target))
+	} else {
+		buf.WriteString(fmt.Sprintf("%s took a plus from %s", user, target))
 	}
 
-	rows, err := c.selDenom.Query()
-	defer rows.Close()
-
-	denoms := make(map[int]string)
-	for rows.Next() {
-		var val int
-		var name string
-		err = rows.Scan(&val, &name)
-		if err != nil {
-			return ""
-		}
-
-		denoms[val] = name
+	if reason != "" {
+		buf.WriteString(" " + reason)
 	}
+	buf.WriteString(", ")
 
-	/*denoms := map[int]string{
-		-5:   "Krossover Kredit",
-		1:    "Schrute Buck",
-		5:    "Stanley Nickel",
-		10:   "Pizza Slice",
-		25:   "Beer",
-		50:   "Glitter Jar",
-		100:  "Rubber Band",
-		150:  "Slap Bracelet",
-		250:  "Leprechaun",
-		500:  "Presidential Fist Bump",
-		1000: "Unicorn",
-	}*/
+	buf.WriteString(fmt.Sprintf("%s now has %s.", target, c.pluralize(val, "plus")))
+	return buf.String()
+}
 
-	// To store the keys in slice in sorted order
-	var keys []int
-	for k := range denoms {
-		keys = append(keys, k)
+// Describes val in the fewest denominations of the set channel uses,
+// spelling out any pluses that don't fit into one.
+func (c *PlusCommand) denominationEquivalent(channel string, val int) string {
+	denoms, err := c.denoms.Get(channel)
+	if err != nil {
+		logger.WithError(err).Error("error reading plus denominations")
+		return ""
 	}
 
-	if val < 0 {
-		sort.Sort(sort.IntSlice(keys))
-	} else {
-		sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	values := make([]int, len(denoms))
+	for i, denom := range denoms {
+		values[i] = denom.value
 	}
 
-	for _, denom := range keys {
-		coins := 0
-		if val > 0 && denom > 0 {
-			for denom <= val {
-				val -= denom
-				coins += 1
-			}
-		} else if val < 0 && denom < 0 {
-			for denom >= val {
-				val -= denom
-				coins += 1
-			}
+	counts, left := makePlusChange(val, values)
+
+	//Largest first for pluses and most negative first for minuses
+	var parts []string
+	for i := range denoms {
+		if val > 0 {
+			i = len(denoms) - 1 - i
 		}
 
-		if coins > 0 {
-			if buf.Len() == 0 {
-				buf.WriteString(c.pluralize(coins, denoms[denom]))
-				continue
-			}
+		if counts[i] > 0 {
+			parts = append(parts, c.pluralize(counts[i], denominationLabel(denoms[i].name, denoms[i].emoji)))
+		}
+	}
 
-			if val == 0 {
-				buf.WriteString(" and ")
-			} else {
-				buf.WriteString(", ")
-			}
+	if len(parts) == 0 {
+		return ""
+	}
 
-			buf.WriteString(c.pluralize(coins, denoms[denom]))
-		}
+	disp := parts[0]
+	if len(parts) > 1 {
+		disp = strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
 	}
 
-	//If we are making an approximation due to denomination gaps.
-	if val != 0 && buf.Len() != 0 {
-		buf.WriteString(" and a little extra")
+	if left != 0 {
+		disp += fmt.Sprintf(", with %s left over", c.pluralize(left, "plus"))
 	}
 
-	return buf.String()
+	return disp
 }
 
 func (c *PlusCommand) pluralize(val int, txt string) string {
@@ -195,7 +638,7 @@ func (c *PlusCommand) pluralize(val int, txt string) string {
 }
 
 func (c *PlusCommand) GetSyntax() string {
-	return "?++|-- <target>"
+	return c.prefix + "++|-- <target> [reason]"
 }
 
 func (c *PlusCommand) GetDescription() string {
@@ -203,35 +646,77 @@ func (c *PlusCommand) GetDescription() string {
 }
 
 func (c *PlusCommand) Close() {
-	c.selDenom.Close()
-	c.sel.Close()
-	c.upd.Close()
-	c.ins.Close()
+	c.addBalance.Close()
+	c.selBalance.Close()
+	c.selKnown.Close()
+	c.insTransfer.Close()
+	c.selReacted.Close()
+	c.limits.Close()
+	c.selAlias.Close()
+	c.ledger.Close()
+	c.upsert.Close()
 }
 
-func NewPlusCommand(rtm *slack.RTM, db *sql.DB) *PlusCommand {
-	exp := regexp.MustCompile(`^\?(\+\+|\-\-) ([\w@<>\|#]+).*$`)
-	db.Exec("CREATE TABLE pluses (target TEXT PRIMARY KEY NOT NULL, count INTEGER)")
+func NewPlusCommand(chat ChatClient, db *sql.DB, denoms *PlusDenominations, cfg PlusConfig, wallet bool) *PlusCommand {
+	exp := regexp.MustCompile(`^` + regexp.QuoteMeta(cfg.Prefix) + `(\+\+|\-\-) ([\w@<>\|#]+)(.*)$`)
+
+	//Adding to the stored count in sql means concurrent pluses can't overwrite each other
+	upsert, err := db.Prepare("INSERT INTO pluses(target, count) VALUES(?,?) ON CONFLICT(target) DO UPDATE SET count = count + excluded.count RETURNING count")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus upsert")
+		return nil
+	}
+
+	ledger, err := db.Prepare("INSERT INTO plus_ledger(giver, target, delta, channel, timestamp, reason) VALUES(?,?,?,?,?,?)")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus ledger insert")
+		return nil
+	}
+
+	limits, err := NewPlusLimiter(db, cfg)
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus limits")
+		return nil
+	}
+
+	selAlias, err := db.Prepare("SELECT target FROM plus_aliases WHERE alias=?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus alias select")
+		return nil
+	}
+
+	selReacted, err := db.Prepare("SELECT COALESCE(SUM(delta), 0) FROM plus_ledger WHERE giver=? AND target=? AND channel=? AND timestamp=?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus reaction select")
+		return nil
+	}
+
+	insTransfer, err := db.Prepare("INSERT INTO plus_transfers(sender, recipient, amount, issuer, channel, timestamp, reason) VALUES(?,?,?,?,?,?,?)")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus transfer insert")
+		return nil
+	}
 
-	ins, err := db.Prepare("INSERT INTO pluses(target, count) VALUES(?,?)")
+	selKnown, err := db.Prepare("SELECT 1 FROM plus_ledger WHERE target=? LIMIT 1")
 	if err != nil {
-		fmt.Printf("error preparing plus insert: %v\n", err)
+		logger.WithError(err).Error("error preparing plus known target select")
 		return nil
 	}
 
-	upd, err := db.Prepare("UPDATE pluses SET count=? WHERE target=?")
+	selBalance, err := db.Prepare("SELECT balance FROM plus_balances WHERE target=?")
 	if err != nil {
-		fmt.Printf("error preparing plus update: %v\n", err)
+		logger.WithError(err).Error("error preparing plus balance select")
 		return nil
 	}
 
-	sel, err := db.Prepare("SELECT count FROM pluses WHERE target=?")
+	addBalance, err := db.Prepare("INSERT INTO plus_balances(target, balance) VALUES(?,?) ON CONFLICT(target) DO UPDATE SET balance = balance + excluded.balance RETURNING balance")
 	if err != nil {
-		fmt.Printf("error preparing plus select: %v\n", err)
+		logger.WithError(err).Error("error preparing plus balance upsert")
 		return nil
 	}
 
-	selDenom, err := db.Prepare("SELECT * FROM plus_denominations")
+	//Targets need at least two characters so things like i++ and C++ are left alone
+	inlineExp := regexp.MustCompile(`(?:^|\s)(<[@#][\w\|.-]+>|@?[A-Za-z][\w.-]*\w)(\+\+|--)`)
 
-	return &PlusCommand{rtm, exp, ins, upd, sel, selDenom}
+	return &PlusCommand{chat, cfg.Prefix, exp, db, upsert, ledger, denoms, selAlias, limits, cfg.Inline, inlineExp, selKnown, cfg.ReactionEmoji, cfg.ReactionThread, selReacted, insTransfer, selBalance, addBalance, wallet, NewPlusUsers(chat)}
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Turns the cooldown off so tests can plus the same target repeatedly
+func noPlusCooldown(cfg *Config) {
+	cfg.Commands.Plus.Cooldown.Duration = 0
+}
+
+func TestPlusCommand(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	bot.expect(testAliceID, "?++ bob", "alice gave a plus to bob, bob now has 1 plus.")
+	bot.expect(testAdminID, "?++ bob for the help", "admin gave a plus to bob for the help, bob now has 2 pluses.")
+	bot.expect(testAliceID, "?-- bob", "alice took a plus from bob, bob now has 1 plus.")
+	bot.expect(testAliceID, "?++ <@UALICE>", "You'll go blind that way.")
+}
+
+func TestPlusResolvesNames(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	bot.expect(testAliceID, "?++ alice", "You'll go blind that way.")
+	bot.expect(testAliceID, "?++ @Alice", "You'll go blind that way.")
+	bot.expect(testAliceID, "thanks alice++", "You'll go blind that way.")
+
+	bot.expect(testAliceID, "?-- bob", "alice took a plus from bob, bob now has -1 pluses.")
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 0 pluses.")
+
+	var texts int
+	err := bot.db.QueryRow("SELECT COUNT(*) FROM pluses WHERE target NOT LIKE '<@%'").Scan(&texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if texts != 0 {
+		t.Errorf("expected people to only be stored by id, found %d other targets", texts)
+	}
+}
+
+func TestPlusInline(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	bot.expect(testAliceID, "thanks bob++ for that", "alice gave a plus to bob, bob now has 1 plus.")
+
+	bot.expect(testAliceID, "<@UBOB>-- for breaking the build", "alice took a plus from <@UBOB>, <@UBOB> now has 0 pluses.")
+	bot.expect(testAliceID, "sorry bob--", "alice took a plus from bob, bob now has -1 pluses.")
+
+	ignored := []string{
+		"`i++` is fine",
+		"well-- I think so",
+		"bob--, really?",
+		"c--",
+	}
+
+	for _, txt := range ignored {
+		replies := bot.say(testAliceID, txt)
+		if len(replies) != 0 {
+			t.Errorf("expected %q to be ignored, got %q", txt, replies)
+		}
+	}
+}
+
+func TestPlusInlineExplicitTargets(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	//Nothing has given build-server a plus yet, the @ says it's a target anyway
+	bot.expect(testAliceID, "@build-server-- is down again", "alice took a plus from build-server, build-server now has -1 pluses.")
+	bot.expect(testAliceID, "<#CGENERAL>-- too noisy", "alice took a plus from <#CGENERAL>, <#CGENERAL> now has -1 pluses.")
+
+	replies := bot.say(testAdminID, "?++endseason Spring")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "That's the end of Spring") {
+		t.Fatalf("expected the season to end, got %q", replies)
+	}
+
+	//Still known once the season has emptied the counts
+	bot.expect(testAliceID, "build-server-- again", "alice took a plus from build-server, build-server now has -1 pluses.")
+	bot.expect(testAliceID, "bob-- too", "alice took a plus from bob, bob now has -1 pluses.")
+}
+
+func TestPlusInlineIgnoresBots(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	msg := &Message{User: testAdminID, Channel: testChannelID, Text: "thanks alice++", Timestamp: "1.1", Bot: true}
+	bot.router.Dispatch(context.Background(), bot.chat, msg)
+
+	sent, _, _ := bot.chat.Flush()
+	if len(sent) != 0 {
+		t.Errorf("expected a bot's message to be ignored, got %+v", sent)
+	}
+}
+
+func TestPlusCooldown(t *testing.T) {
+	bot := newTestBot(t, func(cfg *Config) {
+		cfg.Commands.Plus.Cooldown.Duration = time.Hour
+	})
+
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.")
+
+	//The wait depends on how long the first plus took so only check the start
+	replies := bot.say(testAliceID, "?++ <@UBOB>")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "Easy there, you can change bob's pluses again in ") {
+		t.Errorf("expected the cooldown to refuse a second plus, got %q", replies)
+	}
+}
+
+func TestPlusConsecutiveMinuses(t *testing.T) {
+	bot := newTestBot(t, func(cfg *Config) {
+		noPlusCooldown(cfg)
+		cfg.Commands.Plus.MaxConsecutiveMinuses = 2
+	})
+
+	bot.expect(testAliceID, "?-- <@UBOB>", "alice took a plus from <@UBOB>, <@UBOB> now has -1 pluses.")
+	bot.expect(testAliceID, "?-- <@UBOB>", "alice took a plus from <@UBOB>, <@UBOB> now has -2 pluses.")
+	bot.expect(testAliceID, "?-- <@UBOB>", "That's 2 minuses in a row for bob from you. Maybe give them a break.")
+}
+
+func TestPlusConcurrentGivers(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	//Every giver is someone different so none of them hit the limits
+	const givers = 100
+	var wg sync.WaitGroup
+	for i := 0; i < givers; i++ {
+		id := fmt.Sprintf("U%03d", i)
+		bot.chat.AddUser(id, fmt.Sprintf("user%03d", i))
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			msg := &Message{User: id, Channel: testChannelID, Text: "?++ <@UBOB>", Timestamp: fmt.Sprintf("2.%03d", i)}
+			bot.router.Dispatch(context.Background(), bot.chat, msg)
+		}(i)
+	}
+	wg.Wait()
+
+	sent, _, _ := bot.chat.Flush()
+	if len(sent) != givers {
+		t.Errorf("expected %d replies, got %d", givers, len(sent))
+	}
+
+	var count, total, entries int
+	err := bot.db.QueryRow("SELECT count FROM pluses WHERE target=?", userTarget(testBobID)).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bot.db.QueryRow("SELECT COALESCE(SUM(delta), 0), COUNT(*) FROM plus_ledger WHERE target=?", userTarget(testBobID)).Scan(&total, &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != givers || total != givers || entries != givers {
+		t.Errorf("expected %d pluses, got a count of %d and %d ledger entries adding up to %d", givers, count, entries, total)
+	}
+}
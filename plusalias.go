@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PlusAliasCommand folds duplicate targets (bob, robert and bobby) into
+// one. Aliasing and merging are left to the admin since they can't
+// easily be undone.
+type PlusAliasCommand struct {
+	chat   ChatClient
+	prefix string
+	admin  string
+	plus   *PlusCommand
+	db     *sql.DB
+	exp    *regexp.Regexp
+	ins    *sql.Stmt
+	sel    *sql.Stmt
+	exists *sql.Stmt
+}
+
+func (c *PlusAliasCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusAliasCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	token := strings.ToLower(vars[1])
+	args := strings.Fields(vars[2])
+
+	if token == "++aliases" {
+		if len(args) != 1 {
+			return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+		}
+
+		disp, err := c.getAliasesDisplay(ctx, args[0])
+		return NewOutgoingMessage(disp, msg.Channel), err
+	}
+
+	if len(args) != 2 {
+		return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+	}
+
+	if msg.User != c.admin {
+		return NewOutgoingMessage("Only the admin can do that.", msg.Channel), nil
+	}
+
+	//An alias can be pointed somewhere else, so it's the alias itself
+	//that moves rather than what it currently resolves to
+	from, into := c.plus.normalizeTarget(args[0]), c.plus.parseTarget(args[1])
+	if token == "++merge" {
+		from = c.plus.parseTarget(args[0])
+	}
+
+	if c.plus.parseTarget(args[0]) == into {
+		return NewOutgoingMessage(fmt.Sprintf("%s and %s are already the same thing.", args[0], args[1]), msg.Channel), nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.Stmt(c.exists).QueryRow(from, from, from, from, from).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return NewOutgoingMessage(fmt.Sprintf("There's nothing called %s to %s.", args[0], strings.TrimPrefix(token, "++")), msg.Channel), nil
+	}
+
+	//Anything already stored under the alias moves over too so nothing gets orphaned
+	err = mergePlusTargets(tx, from, into)
+	if err != nil {
+		return nil, err
+	}
+
+	if token == "++alias" {
+		_, err = tx.Stmt(c.ins).Exec(from, into)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	if token == "++alias" {
+		return NewOutgoingMessage(fmt.Sprintf("OK, %s is now an alias for %s.", args[0], args[1]), msg.Channel), nil
+	}
+
+	return NewOutgoingMessage(fmt.Sprintf("OK, merged %s into %s.", args[0], args[1]), msg.Channel), nil
+}
+
+func (c *PlusAliasCommand) getAliasesDisplay(ctx context.Context, txt string) (string, error) {
+	target := c.plus.parseTarget(txt)
+	rows, err := c.sel.QueryContext(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		err = rows.Scan(&alias)
+		if err != nil {
+			return "", err
+		}
+
+		aliases = append(aliases, c.plus.targetName(alias))
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	name := c.plus.targetName(target)
+	if len(aliases) == 0 {
+		return fmt.Sprintf("%s doesn't go by anything else.", name), nil
+	}
+
+	return fmt.Sprintf("%s is also known as %s", name, strings.Join(aliases, ", ")), nil
+}
+
+func (c *PlusAliasCommand) GetSyntax() string {
+	return c.prefix + "++alias <alias> <target>, " + c.prefix + "++merge <from> <into> or " + c.prefix + "++aliases <target>"
+}
+
+func (c *PlusAliasCommand) GetDescription() string {
+	return "Combine targets that are really the same thing. Only the admin can add aliases or merge"
+}
+
+func (c *PlusAliasCommand) Close() {
+	c.exists.Close()
+	c.sel.Close()
+	c.ins.Close()
+}
+
+func NewPlusAliasCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusAliasCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(\+\+aliases|\+\+alias|\+\+merge)(?:\s+(.*))?$`)
+
+	ins, err := db.Prepare("INSERT OR REPLACE INTO plus_aliases(alias, target) VALUES(?,?)")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus alias insert")
+		return nil
+	}
+
+	sel, err := db.Prepare("SELECT alias FROM plus_aliases WHERE target=? ORDER BY alias")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus alias select")
+		return nil
+	}
+
+	//Anything that has ever had pluses, moved them or been aliased
+	exists, err := db.Prepare(`SELECT EXISTS(SELECT 1 FROM pluses WHERE target=?)
+		OR EXISTS(SELECT 1 FROM plus_ledger WHERE target=?)
+		OR EXISTS(SELECT 1 FROM plus_transfers WHERE sender=? OR recipient=?)
+		OR EXISTS(SELECT 1 FROM plus_aliases WHERE alias=?)`)
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus alias exists select")
+		return nil
+	}
+
+	return &PlusAliasCommand{chat, cfg.Prefix, cfg.Admin, plus, db, exp, ins, sel, exists}
+}
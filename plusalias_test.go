@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPlusMerge(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	bot.expect(testAliceID, "?++ robert", "alice gave a plus to robert, robert now has 1 plus.")
+	bot.expect(testAliceID, "?++ robert", "alice gave a plus to robert, robert now has 2 pluses.")
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.")
+
+	bot.expect(testAliceID, "?++merge robert <@UBOB>", "Only the admin can do that.")
+	bot.expect(testAdminID, "?++merge bobby <@UBOB>", "There's nothing called bobby to merge.")
+	bot.expect(testAdminID, "?++merge bob <@UBOB>", "bob and <@UBOB> are already the same thing.")
+	bot.expect(testAdminID, "?++merge robert <@UBOB>", "OK, merged robert into <@UBOB>.")
+
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 4 pluses.")
+
+	for target, want := range map[string]int{"<@UBOB>": 4, "robert": 0} {
+		var rows int
+		err := bot.db.QueryRow("SELECT COUNT(*) FROM plus_ledger WHERE target=?", target).Scan(&rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rows != want {
+			t.Errorf("expected %d ledger rows for %s, got %d", want, target, rows)
+		}
+	}
+
+	//Merging doesn't redirect later pluses
+	bot.expect(testAliceID, "?++ robert", "alice gave a plus to robert, robert now has 1 plus.")
+}
+
+func TestPlusAlias(t *testing.T) {
+	bot := newTestBot(t, noPlusCooldown)
+
+	bot.expect(testAliceID, "?++ bobby", "alice gave a plus to bobby, bobby now has 1 plus.")
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.")
+
+	bot.expect(testAdminID, "?++alias robert <@UBOB>", "There's nothing called robert to alias.")
+	bot.expect(testAdminID, "?++alias bobby <@UBOB>", "OK, bobby is now an alias for <@UBOB>.")
+	bot.expect(testAdminID, "?++alias bobby <@UBOB>", "bobby and <@UBOB> are already the same thing.")
+
+	//Pluses for the alias go to the target from now on
+	bot.expect(testAliceID, "?++ bobby", "alice gave a plus to bobby, bobby now has 3 pluses.")
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 4 pluses.")
+
+	bot.expect(testAliceID, "?++aliases <@UBOB>", "bob is also known as bobby")
+	bot.expect(testAliceID, "?++aliases bobby", "bob is also known as bobby")
+	bot.expect(testAliceID, "?++aliases <@UALICE>", "alice doesn't go by anything else.")
+}
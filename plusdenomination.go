@@ -2,131 +2,751 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"github.com/nlopes/slack"
+	"html"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 )
 
+// The most running totals makePlusChange will search through. Amounts
+// too big for that are paid down with the largest denomination first.
+const maxPlusChangeStates = 1 << 14
+
+// The denomination set channels use until they pick another
+const defaultPlusDenominationSet = "default"
+
+var plusDenominationMigrations = []Migration{
+	{1, "create plus_denominations", execMigration(
+		"CREATE TABLE IF NOT EXISTS plus_denominations (value INTEGER PRIMARY KEY NOT NULL, name TEXT)",
+	)},
+	{2, "group plus_denominations into sets", execMigration(
+		"ALTER TABLE plus_denominations RENAME TO plus_denominations_old",
+		"CREATE TABLE plus_denominations (denomination_set TEXT NOT NULL, value INTEGER NOT NULL, name TEXT, PRIMARY KEY (denomination_set, value))",
+		"INSERT INTO plus_denominations(denomination_set, value, name) SELECT 'default', value, name FROM plus_denominations_old",
+		"DROP TABLE plus_denominations_old",
+		"CREATE TABLE IF NOT EXISTS plus_denomination_channels (channel TEXT PRIMARY KEY NOT NULL, denomination_set TEXT NOT NULL)",
+	)},
+	{3, "add plus_denominations emoji", execMigration(
+		"ALTER TABLE plus_denominations ADD COLUMN emoji TEXT NOT NULL DEFAULT ''",
+	)},
+}
+
+type plusDenomination struct {
+	value int
+	name  string
+	emoji string
+}
+
+// PlusDenominations keeps every denomination set, and which channels use
+// them, in memory so working out an equivalent doesn't read the database
+// on every plus. Anything that changes either table needs to Reset it.
+type PlusDenominations struct {
+	db       *sql.DB
+	mu       sync.Mutex
+	sets     map[string][]plusDenomination
+	channels map[string]string
+}
+
+// Returns the name of the set channel uses
+func (d *PlusDenominations) Set(channel string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return "", err
+	}
+
+	return d.set(channel), nil
+}
+
+// Returns the denominations of the set channel uses ordered by value
+func (d *PlusDenominations) Get(channel string) ([]plusDenomination, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.sets[d.set(channel)], nil
+}
+
+func (d *PlusDenominations) set(channel string) string {
+	if set, ok := d.channels[channel]; ok {
+		return set
+	}
+
+	return defaultPlusDenominationSet
+}
+
+func (d *PlusDenominations) load() error {
+	if d.sets != nil {
+		return nil
+	}
+
+	rows, err := d.db.Query("SELECT denomination_set, value, name, emoji FROM plus_denominations ORDER BY value ASC")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sets := make(map[string][]plusDenomination)
+	for rows.Next() {
+		var set string
+		var denom plusDenomination
+		err = rows.Scan(&set, &denom.value, &denom.name, &denom.emoji)
+		if err != nil {
+			return err
+		}
+
+		sets[set] = append(sets[set], denom)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = d.db.Query("SELECT channel, denomination_set FROM plus_denomination_channels")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	channels := make(map[string]string)
+	for rows.Next() {
+		var channel, set string
+		err = rows.Scan(&channel, &set)
+		if err != nil {
+			return err
+		}
+
+		channels[channel] = set
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	d.sets, d.channels = sets, channels
+	return nil
+}
+
+func (d *PlusDenominations) Reset() {
+	d.mu.Lock()
+	d.sets, d.channels = nil, nil
+	d.mu.Unlock()
+}
+
+func NewPlusDenominations(db *sql.DB) *PlusDenominations {
+	return &PlusDenominations{db: db}
+}
+
+// Works out the fewest of each value that add up to val. When no mix of
+// values adds up exactly it gets as close as it can without going past
+// val, and whatever is left over is returned alongside the counts.
+//
+// Values can be negative, so this is a breadth first search over running
+// totals. The items of any mix can be ordered so the running total never
+// strays more than the largest value outside of 0 to val, which keeps
+// the search finite. Big amounts are paid down with the largest value
+// going the same way as val until what's left fits in
+// maxPlusChangeStates, and if even that won't fit it's greedy throughout.
+func makePlusChange(val int, values []int) ([]int, int) {
+	counts := make([]int, len(values))
+	if val == 0 || len(values) == 0 {
+		return counts, val
+	}
+
+	largest, bulk := 0, -1
+	for i, v := range values {
+		if abs(v) > largest {
+			largest = abs(v)
+		}
+
+		if v*val > 0 && (bulk == -1 || abs(v) > abs(values[bulk])) {
+			bulk = i
+		}
+	}
+
+	//How far past val the search can go, and what that leaves for val
+	room := maxPlusChangeStates - 2*largest - 1
+	if abs(val) > room {
+		if bulk == -1 || room < largest {
+			return greedyPlusChange(val, values)
+		}
+
+		//Leaves between room-largest and room to search, on the same side of zero
+		n := (abs(val) - room + abs(values[bulk]) - 1) / abs(values[bulk])
+		counts[bulk] += n
+		val -= n * values[bulk]
+	}
+
+	left := searchPlusChange(val, values, largest, counts)
+	return counts, left
+}
+
+// The breadth first search for makePlusChange. Counts for the best mix
+// are added to counts and what's left over of val is returned.
+func searchPlusChange(val int, values []int, largest int, counts []int) int {
+	lo, hi := -largest, val+largest
+	if val < 0 {
+		lo, hi = val-largest, largest
+	}
+
+	//Index i is the running total lo+i. via is the value index used to
+	//reach it, -1 for totals not reached yet
+	via := make([]int32, hi-lo+1)
+	for i := range via {
+		via[i] = -1
+	}
+
+	queue := []int{-lo}
+	via[-lo] = int32(len(values))
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for i, v := range values {
+			next := cur + v
+			if v == 0 || next < 0 || next >= len(via) || via[next] != -1 {
+				continue
+			}
+
+			via[next] = int32(i)
+			queue = append(queue, next)
+		}
+	}
+
+	//Find the reachable total closest to val on the same side of zero
+	best := -lo
+	step := 1
+	if val < 0 {
+		step = -1
+	}
+	for total := -lo + val; total != -lo; total -= step {
+		if via[total] != -1 {
+			best = total
+			break
+		}
+	}
+
+	for cur := best; cur != -lo; cur -= values[via[cur]] {
+		counts[via[cur]]++
+	}
+
+	return val - (best + lo)
+}
+
+// Takes as many of the biggest values going the same way as val as fit,
+// then the next biggest and so on. It doesn't always find the fewest,
+// or an exact mix when there is one, but it's quick for any amount.
+func greedyPlusChange(val int, values []int) ([]int, int) {
+	counts := make([]int, len(values))
+
+	order := make([]int, 0, len(values))
+	for i, v := range values {
+		if v*val > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return abs(values[order[a]]) > abs(values[order[b]])
+	})
+
+	for _, i := range order {
+		counts[i] = val / values[i]
+		val -= counts[i] * values[i]
+	}
+
+	return counts, val
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+
+	return val
+}
+
+// The shape denomination sets are imported and exported in
+type plusDenominationJSON struct {
+	Value int    `json:"value"`
+	Name  string `json:"name"`
+	Emoji string `json:"emoji,omitempty"`
+}
+
+// PlusDenominationCommand manages the denominations of whichever set the
+// channel it's used in has picked. Names are unique within a set.
 type PlusDenominationCommand struct {
-	rtm *slack.RTM
-	exp *regexp.Regexp
-	ins *sql.Stmt
-	del *sql.Stmt
-	sel *sql.Stmt
+	chat   ChatClient
+	prefix string
+	db     *sql.DB
+	denoms *PlusDenominations
+	exp    *regexp.Regexp
+	subExp *regexp.Regexp
+	ins    *sql.Stmt
+	del    *sql.Stmt
+	sel    *sql.Stmt
+	dup    *sql.Stmt
+	rename *sql.Stmt
+	use    *sql.Stmt
+	sets   *sql.Stmt
 }
 
-func (c *PlusDenominationCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return (msg.Text == "?++d" || msg.Text == "?--d" || c.exp.MatchString(msg.Text)), false
+// Matches a denomination name with an optional :emoji: after it
+var plusDenominationNameExp = regexp.MustCompile(`^(.+?)(?:\s+(:[\w+-]+:))?$`)
+
+// Matches the same emoji as plusDenominationNameExp on its own
+var plusDenominationEmojiExp = regexp.MustCompile(`^:[\w+-]+:$`)
+
+func (c *PlusDenominationCommand) Matches(msg *Message) bool {
+	return msg.Text == c.prefix+"++d" || msg.Text == c.prefix+"--d" || c.exp.MatchString(msg.Text) || c.subExp.MatchString(msg.Text)
 }
 
-func (c *PlusDenominationCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
-	txt := strings.SplitN(msg.Text, " ", 3)
-	token := strings.ToLower(txt[0][1:])
+func (c *PlusDenominationCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	if vars := c.subExp.FindStringSubmatch(msg.Text); vars != nil {
+		return c.executeSub(ctx, msg, strings.ToLower(vars[1]), strings.TrimSpace(vars[2]))
+	}
 
-	if len(txt) == 1 {
-		disp, err := c.getDenominationsDisplay()
-		out := c.rtm.NewOutgoingMessage(disp, msg.Channel)
-		return out, err
-	} else if len(txt) < 3 {
-		disp := c.GetSyntax()
-		out := c.rtm.NewOutgoingMessage(disp, msg.Channel)
-		return out, nil
+	//Denominations are added to and removed from the set the channel uses
+	set, err := c.denoms.Set(msg.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	if vars == nil {
+		disp, err := c.getDenominationsDisplay(set)
+		return NewOutgoingMessage(disp, msg.Channel), err
 	}
 
-	idx, err := strconv.Atoi(txt[1])
+	idx, err := strconv.Atoi(vars[2])
 	if err != nil {
-		disp := c.GetSyntax()
-		out := c.rtm.NewOutgoingMessage(disp, msg.Channel)
-		return out, err
+		return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
 	}
 
 	if idx == 0 {
-		out := c.rtm.NewOutgoingMessage("0 ain't no denomination!", msg.Channel)
+		out := NewOutgoingMessage("0 ain't no denomination!", msg.Channel)
 		return out, nil
 	}
 
-	c.del.Exec(idx)
+	var disp string
+	if vars[1] == "--" && vars[3] != "" {
+		//Only the value picks what's removed, so a name would be ignored
+		disp = c.GetSyntax()
+	} else if vars[1] == "--" {
+		disp, err = c.remove(ctx, set, idx)
+	} else if vars[3] == "" {
+		disp = c.GetSyntax()
+	} else {
+		name := plusDenominationNameExp.FindStringSubmatch(vars[3])
+		disp, err = c.add(ctx, set, idx, name[1], name[2])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOutgoingMessage(disp, msg.Channel), nil
+}
+
+func (c *PlusDenominationCommand) executeSub(ctx context.Context, msg *Message, token string, arg string) (*OutgoingMessage, error) {
+	if token == "sets" {
+		disp, err := c.getSetsDisplay(ctx, msg.Channel)
+		return NewOutgoingMessage(disp, msg.Channel), err
+	}
+
+	if token == "use" {
+		if arg == "" || strings.ContainsAny(arg, " \t\n") {
+			return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+		}
+
+		disp, err := c.useSet(ctx, msg.Channel, strings.ToLower(arg))
+		return NewOutgoingMessage(disp, msg.Channel), err
+	}
+
+	set, err := c.denoms.Set(msg.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	var disp string
+	switch token {
+	case "export":
+		disp, err = c.export(ctx, set)
+
+	case "import":
+		disp, err = c.importSet(ctx, set, arg)
+
+	case "rename":
+		parts := strings.SplitN(arg, " ", 2)
+		idx, convErr := strconv.Atoi(parts[0])
+		if convErr != nil || len(parts) < 2 {
+			disp = c.GetSyntax()
+			break
+		}
+
+		disp, err = c.renameDenomination(ctx, set, idx, strings.TrimSpace(parts[1]))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOutgoingMessage(disp, msg.Channel), nil
+}
+
+// Adds a denomination or replaces the one already worth val
+func (c *PlusDenominationCommand) add(ctx context.Context, set string, val int, name string, emoji string) (string, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	taken, err := c.nameTaken(tx, set, val, name)
+	if taken != "" || err != nil {
+		return taken, err
+	}
+
+	_, err = tx.Stmt(c.ins).Exec(set, val, name, emoji)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	c.denoms.Reset()
+	if err != nil {
+		return "", err
+	}
 
-	if token == "++d" {
-		_, err := c.ins.Exec(idx, txt[2])
+	return fmt.Sprintf("OK, added plus denomination %s", denominationLabel(name, emoji)), nil
+}
+
+func (c *PlusDenominationCommand) remove(ctx context.Context, set string, val int) (string, error) {
+	var name, emoji string
+	err := c.del.QueryRowContext(ctx, set, val).Scan(&name, &emoji)
+	c.denoms.Reset()
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("There isn't a denomination worth %d in %s.", val, set), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("OK, removed plus denomination %s (%d)", denominationLabel(name, emoji), val), nil
+}
+
+func (c *PlusDenominationCommand) renameDenomination(ctx context.Context, set string, val int, txt string) (string, error) {
+	vars := plusDenominationNameExp.FindStringSubmatch(txt)
+	name, emoji := vars[1], vars[2]
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	taken, err := c.nameTaken(tx, set, val, name)
+	if taken != "" || err != nil {
+		return taken, err
+	}
+
+	var old string
+	err = tx.QueryRow("SELECT name FROM plus_denominations WHERE denomination_set=? AND value=?", set, val).Scan(&old)
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("There isn't a denomination worth %d in %s.", val, set), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Stmt(c.rename).Exec(name, emoji, set, val)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	c.denoms.Reset()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("OK, %s is now %s", old, denominationLabel(name, emoji)), nil
+}
+
+// Returns a refusal if a denomination other than the one worth val
+// already goes by name
+func (c *PlusDenominationCommand) nameTaken(tx *sql.Tx, set string, val int, name string) (string, error) {
+	var other int
+	err := tx.Stmt(c.dup).QueryRow(set, name, val).Scan(&other, &name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("There's already a %s worth %d in %s.", name, other, set), nil
+}
+
+func (c *PlusDenominationCommand) export(ctx context.Context, set string) (string, error) {
+	rows, err := c.sel.QueryContext(ctx, set)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	denoms := []plusDenominationJSON{}
+	for rows.Next() {
+		var denom plusDenominationJSON
+		err = rows.Scan(&denom.Value, &denom.Name, &denom.Emoji)
 		if err != nil {
-			disp := c.GetSyntax()
-			out := c.rtm.NewOutgoingMessage(disp, msg.Channel)
-			return out, err
+			return "", err
 		}
-		out := c.rtm.NewOutgoingMessage(fmt.Sprintf("OK, added plus denomination %s", txt[2]), msg.Channel)
-		return out, nil
+
+		denoms = append(denoms, denom)
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", err
 	}
 
-	out := c.rtm.NewOutgoingMessage(fmt.Sprintf("OK, removed plus denomination %s", txt[2]), msg.Channel)
-	return out, nil
+	out, err := json.MarshalIndent(denoms, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Here's %s, `%s++d import` it to copy it into another set\n```%s```", set, c.prefix, out), nil
 }
 
-func (c *PlusDenominationCommand) getDenominationsDisplay() (string, error) {
-	rows, err := c.sel.Query()
+// Replaces every denomination in set with the ones in txt. Nothing is
+// changed unless they are all valid.
+func (c *PlusDenominationCommand) importSet(ctx context.Context, set string, txt string) (string, error) {
+	//Slack escapes a few characters and people tend to paste json as code
+	txt = html.UnescapeString(strings.Trim(txt, "` \n"))
+
+	var denoms []plusDenominationJSON
+	err := json.Unmarshal([]byte(txt), &denoms)
+	if err != nil {
+		return fmt.Sprintf("That isn't a list of denominations: %s", err), nil
+	}
+
+	values := make(map[int]bool)
+	names := make(map[string]bool)
+	for _, denom := range denoms {
+		name := strings.ToLower(strings.TrimSpace(denom.Name))
+		switch {
+		case denom.Value == 0:
+			return "0 ain't no denomination!", nil
+		case name == "":
+			return fmt.Sprintf("The denomination worth %d needs a name.", denom.Value), nil
+		case values[denom.Value]:
+			return fmt.Sprintf("There's more than one denomination worth %d.", denom.Value), nil
+		case names[name]:
+			return fmt.Sprintf("There's more than one denomination called %s.", denom.Name), nil
+		case denom.Emoji != "" && !plusDenominationEmojiExp.MatchString(denom.Emoji):
+			return fmt.Sprintf("The denomination worth %d has %q for an emoji, emoji look like :beer:.", denom.Value, denom.Emoji), nil
+		}
+
+		values[denom.Value], names[name] = true, true
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM plus_denominations WHERE denomination_set=?", set)
 	if err != nil {
-		rows.Close()
 		return "", err
 	}
 
-	buf := bytes.NewBufferString("Here's the current plus exchange rate\n```")
+	for _, denom := range denoms {
+		_, err = tx.Stmt(c.ins).Exec(set, denom.Value, strings.TrimSpace(denom.Name), denom.Emoji)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = tx.Commit()
+	c.denoms.Reset()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("OK, %s now has %d denominations.", set, len(denoms)), nil
+}
+
+func (c *PlusDenominationCommand) useSet(ctx context.Context, channel string, set string) (string, error) {
+	_, err := c.use.ExecContext(ctx, channel, set)
+	c.denoms.Reset()
+	if err != nil {
+		return "", err
+	}
+
+	denoms, err := c.denoms.Get(channel)
+	if err != nil {
+		return "", err
+	}
+
+	disp := fmt.Sprintf("OK, this channel now uses the %s denominations.", set)
+	if len(denoms) == 0 {
+		disp += fmt.Sprintf(" There aren't any yet, add some with `%s++d <plus count> <name>`.", c.prefix)
+	}
+
+	return disp, nil
+}
+
+func (c *PlusDenominationCommand) getSetsDisplay(ctx context.Context, channel string) (string, error) {
+	current, err := c.denoms.Set(channel)
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := c.sets.QueryContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	buf := bytes.NewBufferString("Here are the denomination sets\n```")
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	for rows.Next() {
+		var set string
+		var count int
+		err = rows.Scan(&set, &count)
+		if err != nil {
+			return "", err
+		}
+
+		noun := "denominations"
+		if count == 1 {
+			noun = "denomination"
+		}
+
+		fmt.Fprintf(w, "%s\t%d %s", set, count, noun)
+		if set == current {
+			fmt.Fprint(w, "\t(this channel)")
+		}
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprint(w, "```")
+	w.Flush()
+
+	return buf.String(), rows.Err()
+}
+
+func (c *PlusDenominationCommand) getDenominationsDisplay(set string) (string, error) {
+	rows, err := c.sel.Query(set)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	buf := bytes.NewBufferString(fmt.Sprintf("Here's the current plus exchange rate (%s)\n```", set))
 	w := tabwriter.NewWriter(buf, 7, 0, 1, ' ', 0)
 	for rows.Next() {
 		var val int
-		var name string
-		err = rows.Scan(&val, &name)
+		var name, emoji string
+		err = rows.Scan(&val, &name, &emoji)
 		if err != nil {
-			rows.Close()
 			return "", err
 		}
 
-		fmt.Fprintf(w, "%d:\t%s\n", val, name)
+		fmt.Fprintf(w, "%d:\t%s\n", val, denominationLabel(name, emoji))
 	}
 	fmt.Fprint(w, "```")
 	w.Flush()
-	rows.Close()
-	return buf.String(), nil
+	return buf.String(), rows.Err()
+}
+
+// Puts a denomination's emoji, when it has one, in front of its name
+func denominationLabel(name string, emoji string) string {
+	if emoji == "" {
+		return name
+	}
+
+	return emoji + " " + name
 }
 
 func (c *PlusDenominationCommand) GetSyntax() string {
-	return "?(++|--)d <plus count> <name>"
+	return c.prefix + "++d <plus count> <name> [:emoji:], " + c.prefix + "--d <plus count>, " +
+		c.prefix + "++d rename <plus count> <name> [:emoji:], " + c.prefix + "++d use <set>, " + c.prefix + "++d sets, " +
+		c.prefix + "++d export or " + c.prefix + "++d import <json>"
 }
 
 func (c *PlusDenominationCommand) GetDescription() string {
-	return "Add or remove denominations for pluses. To view the currently set demoninations type `?++d`"
+	return "Add or remove denominations for pluses in this channel's set, or switch sets. To view the currently set demoninations type `" + c.prefix + "++d`"
 }
 
 func (c *PlusDenominationCommand) Close() {
+	c.sets.Close()
+	c.use.Close()
+	c.rename.Close()
+	c.dup.Close()
 	c.sel.Close()
 	c.ins.Close()
 	c.del.Close()
 }
 
-func NewPlusDenominationCommand(rtm *slack.RTM, db *sql.DB) *PlusDenominationCommand {
-	exp := regexp.MustCompile(`^(?i)\?(\+\+|\-\-)d (\d+?) (.+?)$`)
-	db.Exec("CREATE TABLE plus_denominations (value INTEGER PRIMARY KEY NOT NULL, name TEXT)")
+// Changes are made through the same denominations the plus command
+// reads so it sees them straight away.
+func NewPlusDenominationCommand(chat ChatClient, db *sql.DB, denoms *PlusDenominations, cfg CommandConfig) *PlusDenominationCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(\+\+|\-\-)d (-?\d+)(?: +(.+?))? *$`)
+	subExp := regexp.MustCompile(`^(?is)` + regexp.QuoteMeta(cfg.Prefix) + `\+\+d (sets|use|rename|export|import)(?:\s+(.*))?$`)
+
+	ins, err := db.Prepare("INSERT INTO plus_denominations(denomination_set, value, name, emoji) VALUES(?,?,?,?) ON CONFLICT(denomination_set, value) DO UPDATE SET name = excluded.name, emoji = excluded.emoji")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus_denominations insert")
+		return nil
+	}
+
+	del, err := db.Prepare("DELETE from plus_denominations WHERE denomination_set=? AND value=? RETURNING name, emoji")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus_denominations delete")
+		return nil
+	}
+
+	sel, err := db.Prepare("SELECT value, name, emoji FROM plus_denominations WHERE denomination_set=? ORDER BY value ASC")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus_denominations select")
+		return nil
+	}
+
+	dup, err := db.Prepare("SELECT value, name FROM plus_denominations WHERE denomination_set=? AND name=? COLLATE NOCASE AND value != ?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus_denominations name select")
+		return nil
+	}
 
-	ins, err := db.Prepare("INSERT INTO plus_denominations(value, name) VALUES(?,?)")
+	rename, err := db.Prepare("UPDATE plus_denominations SET name=?, emoji=? WHERE denomination_set=? AND value=?")
 	if err != nil {
-		fmt.Printf("error preparing plus_denominations insert: %v\n", err)
+		logger.WithError(err).Error("error preparing plus_denominations rename")
 		return nil
 	}
 
-	del, err := db.Prepare("DELETE from plus_denominations WHERE value=?")
+	use, err := db.Prepare("INSERT INTO plus_denomination_channels(channel, denomination_set) VALUES(?,?) ON CONFLICT(channel) DO UPDATE SET denomination_set = excluded.denomination_set")
 	if err != nil {
-		fmt.Printf("error preparing plus_denominations delete: %v\n", err)
+		logger.WithError(err).Error("error preparing plus_denomination_channels upsert")
 		return nil
 	}
 
-	sel, err := db.Prepare("SELECT * FROM plus_denominations ORDER BY value ASC")
+	//Sets only exist through their denominations or the channels using them
+	sets, err := db.Prepare(`SELECT s.denomination_set, (SELECT COUNT(*) FROM plus_denominations d WHERE d.denomination_set = s.denomination_set)
+		FROM (SELECT denomination_set FROM plus_denominations UNION SELECT denomination_set FROM plus_denomination_channels UNION SELECT 'default') s
+		ORDER BY s.denomination_set`)
 	if err != nil {
-		fmt.Printf("error preparing plus_denominations select: %v\n", err)
+		logger.WithError(err).Error("error preparing plus_denominations sets select")
 		return nil
 	}
 
-	return &PlusDenominationCommand{rtm, exp, ins, del, sel}
+	return &PlusDenominationCommand{chat, cfg.Prefix, db, denoms, exp, subExp, ins, del, sel, dup, rename, use, sets}
 }
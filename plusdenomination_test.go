@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMakePlusChange(t *testing.T) {
+	tests := []struct {
+		val    int
+		values []int
+		counts []int
+		left   int
+	}{
+		{0, []int{1, 5}, []int{0, 0}, 0},
+		{7, nil, []int{}, 7},
+		{11, []int{1, 5}, []int{1, 2}, 0},
+		//Greedy would take 4+1+1
+		{6, []int{1, 3, 4}, []int{0, 2, 0}, 0},
+		{7, []int{5, -1}, []int{2, 3}, 0},
+		{7, []int{3, 5}, []int{2, 0}, 1},
+		{-9, []int{1, -4}, []int{3, 3}, 0},
+		{-3, []int{1, 5}, []int{0, 0}, -3},
+		//Too big to search so the bulk is paid in fives first
+		{2000000, []int{1, 5}, []int{0, 400000}, 0},
+		{2000003, []int{1, 5}, []int{3, 400000}, 0},
+		{-2000000, []int{-5, 1}, []int{400000, 0}, 0},
+		//A denomination too big to search around at all
+		{3000000002, []int{1, 1000000000}, []int{2, 3}, 0},
+		{-2500000000, []int{1000000000, -1000000000}, []int{0, 2}, -500000000},
+	}
+
+	for _, test := range tests {
+		counts, left := makePlusChange(test.val, test.values)
+		if !reflect.DeepEqual(counts, test.counts) || left != test.left {
+			t.Errorf("makePlusChange(%d, %v) = %v, %d want %v, %d", test.val, test.values, counts, left, test.counts, test.left)
+		}
+	}
+}
+
+func TestPlusDenominationRename(t *testing.T) {
+	bot := newTestBot(t, nil)
+
+	bot.expect(testAliceID, "?++d 5 Coffee", "OK, added plus denomination Coffee")
+	bot.expect(testAliceID, "?++d 25 Beer :beer:", "OK, added plus denomination :beer: Beer")
+
+	bot.expect(testAliceID, "?++d 10 beer", "There's already a Beer worth 25 in default.")
+	bot.expect(testAliceID, "?++d rename 5 BEER", "There's already a Beer worth 25 in default.")
+	bot.expect(testAliceID, "?++d rename 7 Tea", "There isn't a denomination worth 7 in default.")
+	bot.expect(testAliceID, "?++d rename 5 Tea :tea:", "OK, Coffee is now :tea: Tea")
+	//Renaming one to its own name is fine
+	bot.expect(testAliceID, "?++d rename 25 beer", "OK, Beer is now beer")
+
+	bot.expect(testAliceID, "?--d 5 Coffee", "?++d <plus count> <name> [:emoji:], ?--d <plus count>, "+
+		"?++d rename <plus count> <name> [:emoji:], ?++d use <set>, ?++d sets, ?++d export or ?++d import <json>")
+	bot.expect(testAliceID, "?--d 5", "OK, removed plus denomination :tea: Tea (5)")
+	bot.expect(testAliceID, "?--d 5", "There isn't a denomination worth 5 in default.")
+}
+
+func TestPlusDenominationImportExport(t *testing.T) {
+	bot := newTestBot(t, nil)
+
+	//The way slack sends pasted json, in a code block with & and < escaped
+	bot.expect(testAliceID, "?++d import ```[{\"value\": 1, \"name\": \"Fish &amp; Chips\"}, {\"value\": 10, \"name\": \"&lt;3\", \"emoji\": \":heart:\"}]```",
+		"OK, default now has 2 denominations.")
+
+	bot.expect(testAliceID, "?++d export", "Here's default, `?++d import` it to copy it into another set\n```[\n"+
+		"  {\n    \"value\": 1,\n    \"name\": \"Fish \\u0026 Chips\"\n  },\n"+
+		"  {\n    \"value\": 10,\n    \"name\": \"\\u003c3\",\n    \"emoji\": \":heart:\"\n  }\n]```")
+
+	refused := map[string]string{
+		`[{"value": 1, "name": "Fish", "emoji": "heart"}]`:              `The denomination worth 1 has "heart" for an emoji, emoji look like :beer:.`,
+		`[{"value": 1, "name": "Fish"}, {"value": 2, "name": "fish"}]`:  "There's more than one denomination called fish.",
+		`[{"value": 1, "name": "Fish"}, {"value": 1, "name": "Chips"}]`: "There's more than one denomination worth 1.",
+		`[{"value": 0, "name": "Nothing"}]`:                             "0 ain't no denomination!",
+		`[{"value": 3, "name": " "}]`:                                   "The denomination worth 3 needs a name.",
+	}
+
+	for txt, want := range refused {
+		bot.expect(testAliceID, "?++d import "+txt, want)
+	}
+
+	//None of those replaced the set
+	replies := bot.say(testAliceID, "?++d export")
+	if len(replies) != 1 || !strings.Contains(replies[0], "Fish \\u0026 Chips") {
+		t.Errorf("expected the imported set to be left alone, got %q", replies)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// How many targets ?++graph top draws
+const plusGraphTopSize = 5
+
+// Time windows ?++graph understands
+var plusGraphWindows = map[string]time.Duration{
+	"30d": 30 * 24 * time.Hour,
+	"1y":  365 * 24 * time.Hour,
+}
+
+// PlusGraphCommand draws how a target's all time plus total has changed,
+// worked out from the plus ledger, and uploads it as a png.
+type PlusGraphCommand struct {
+	chat    ChatClient
+	prefix  string
+	plus    *PlusCommand
+	exp     *regexp.Regexp
+	before  *sql.Stmt
+	history *sql.Stmt
+	top     *sql.Stmt
+}
+
+func (c *PlusGraphCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusGraphCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	if vars[1] == "" {
+		return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+	}
+
+	window := "30d"
+	if vars[2] != "" {
+		window = strings.ToLower(vars[2])
+	}
+
+	var targets []string
+	if strings.ToLower(vars[1]) == "top" {
+		var err error
+		targets, err = c.getTopTargets(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(targets) == 0 {
+			return NewOutgoingMessage("Nobody has any pluses yet.", msg.Channel), nil
+		}
+	} else {
+		targets = []string{c.plus.parseTarget(vars[1])}
+	}
+
+	now := time.Now().UTC()
+	start := now.Add(-plusGraphWindows[window])
+
+	p := plot.New()
+	p.Title.Text = fmt.Sprintf("Pluses over the last %s", window)
+	p.X.Tick.Marker = plot.TimeTicks{Format: "Jan 2"}
+	p.Y.Label.Text = "Pluses"
+	p.Add(plotter.NewGrid())
+
+	var lines []interface{}
+	for _, target := range targets {
+		xys, err := c.getHistory(ctx, target, start, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if xys == nil {
+			continue
+		}
+
+		lines = append(lines, c.plus.targetName(target), xys)
+	}
+
+	if len(lines) == 0 {
+		return NewOutgoingMessage(fmt.Sprintf("%s hasn't been given any pluses yet.", vars[1]), msg.Channel), nil
+	}
+
+	err := plotutil.AddLines(p, lines...)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := p.WriterTo(8*vg.Inch, 4*vg.Inch, "png")
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err = img.WriteTo(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	//Drawing can be slow, don't upload once the router has given up
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, c.chat.UploadFile(msg.Channel, "pluses.png", p.Title.Text, buf)
+}
+
+// Builds the running total for target between start and end as a
+// stepped line. Returns nil if target has never had any pluses.
+func (c *PlusGraphCommand) getHistory(ctx context.Context, target string, start time.Time, end time.Time) (plotter.XYs, error) {
+	//created_at is stored the way sqlite's CURRENT_TIMESTAMP formats it
+	since := start.Format("2006-01-02 15:04:05")
+
+	var total, changes int
+	err := c.before.QueryRowContext(ctx, target, since).Scan(&total, &changes)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.history.QueryContext(ctx, target, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	xys := plotter.XYs{{X: float64(start.Unix()), Y: float64(total)}}
+	for rows.Next() {
+		var delta int
+		var created time.Time
+		err = rows.Scan(&delta, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		changes++
+		x := float64(created.Unix())
+		xys = append(xys, plotter.XY{X: x, Y: float64(total)})
+		total += delta
+		xys = append(xys, plotter.XY{X: x, Y: float64(total)})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if changes == 0 {
+		return nil, nil
+	}
+
+	return append(xys, plotter.XY{X: float64(end.Unix()), Y: float64(total)}), nil
+}
+
+func (c *PlusGraphCommand) getTopTargets(ctx context.Context) ([]string, error) {
+	rows, err := c.top.QueryContext(ctx, plusGraphTopSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []string
+	for rows.Next() {
+		var target string
+		err = rows.Scan(&target)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+func (c *PlusGraphCommand) GetSyntax() string {
+	return c.prefix + "++graph <target>|top [30d|1y]"
+}
+
+func (c *PlusGraphCommand) GetDescription() string {
+	return "Draws a chart of a target's all time pluses, or the current top five"
+}
+
+func (c *PlusGraphCommand) Close() {
+	c.top.Close()
+	c.history.Close()
+	c.before.Close()
+}
+
+func NewPlusGraphCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusGraphCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `\+\+graph(?: +([\w@<>\|#]+))?(?: +(30d|1y))? *$`)
+
+	before, err := db.Prepare("SELECT COALESCE(SUM(delta), 0), COUNT(*) FROM plus_ledger WHERE target=? AND created_at < ?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus graph total select")
+		return nil
+	}
+
+	history, err := db.Prepare("SELECT delta, created_at FROM plus_ledger WHERE target=? AND created_at >= ? ORDER BY id")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus graph history select")
+		return nil
+	}
+
+	top, err := db.Prepare("SELECT target FROM pluses ORDER BY count DESC, target LIMIT ?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus graph top select")
+		return nil
+	}
+
+	return &PlusGraphCommand{chat, cfg.Prefix, plus, exp, before, history, top}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	defaultLeaderboardSize = 5
+	maxLeaderboardSize     = 25
+)
+
+type plusStanding struct {
+	rank   int
+	target string
+	count  int
+}
+
+// PlusLeaderboardCommand shows where targets stand against each other.
+// Ranks are shared by ties (1, 2, 2, 4) and a list includes everyone
+// tied with its last entry, up to maxLeaderboardSize.
+type PlusLeaderboardCommand struct {
+	chat   ChatClient
+	prefix string
+	plus   *PlusCommand
+	exp    *regexp.Regexp
+	top    *sql.Stmt
+	bottom *sql.Stmt
+	rank   *sql.Stmt
+}
+
+func (c *PlusLeaderboardCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusLeaderboardCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	token := strings.ToLower(vars[1])
+
+	if token == "rank" {
+		if vars[2] == "" {
+			return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+		}
+
+		disp, err := c.getRankDisplay(msg.Channel, vars[2])
+		return NewOutgoingMessage(disp, msg.Channel), err
+	}
+
+	size := defaultLeaderboardSize
+	if vars[2] != "" {
+		n, err := strconv.Atoi(vars[2])
+		if err != nil || n < 1 {
+			return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+		}
+
+		size = n
+		if size > maxLeaderboardSize {
+			size = maxLeaderboardSize
+		}
+	}
+
+	stmt, title := c.top, "top"
+	if token == "--bottom" {
+		stmt, title = c.bottom, "bottom"
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	standings, more, err := readPlusStandings(rows, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(standings) == 0 {
+		return NewOutgoingMessage("Nobody has any pluses yet.", msg.Channel), nil
+	}
+
+	disp := getPlusStandingsDisplay(c.plus, msg.Channel, fmt.Sprintf("Here's the %s %d", title, len(standings)), standings, more)
+	return NewOutgoingMessage(disp, msg.Channel), nil
+}
+
+// Reads up to size standings from rows of target, count and rank,
+// carrying on past size while the entries are tied with the last one.
+// A tie never takes the list past maxLeaderboardSize, how many more were
+// tied is returned instead.
+func readPlusStandings(rows *sql.Rows, size int) ([]plusStanding, int, error) {
+	defer rows.Close()
+
+	var standings []plusStanding
+	more := 0
+	for rows.Next() {
+		var s plusStanding
+		err := rows.Scan(&s.target, &s.count, &s.rank)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(standings) >= size && s.count != standings[len(standings)-1].count {
+			break
+		}
+
+		if len(standings) >= size && len(standings) >= maxLeaderboardSize {
+			more++
+			continue
+		}
+
+		standings = append(standings, s)
+	}
+
+	return standings, more, rows.Err()
+}
+
+func getPlusStandingsDisplay(plus *PlusCommand, channel string, title string, standings []plusStanding, more int) string {
+	buf := bytes.NewBufferString(title + "\n```")
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	for _, s := range standings {
+		fmt.Fprintf(w, "%d.\t%s\t%s\t%s\n", s.rank, plus.targetName(s.target), plus.pluralize(s.count, "plus"), plus.denominationEquivalent(channel, s.count))
+	}
+	fmt.Fprint(w, "```")
+	w.Flush()
+
+	if more > 0 {
+		fmt.Fprintf(buf, "\nand %d more tied", more)
+	}
+
+	return buf.String()
+}
+
+func (c *PlusLeaderboardCommand) getRankDisplay(channel string, txt string) (string, error) {
+	target := c.plus.parseTarget(txt)
+
+	var count, rank, tied, total int
+	err := c.rank.QueryRow(target).Scan(&count, &rank, &tied, &total)
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("%s hasn't been given any pluses yet.", txt), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf("%s is ranked %d of %d with %s", txt, rank, total, c.plus.pluralize(count, "plus")))
+	if tied == 1 {
+		buf.WriteString(", tied with 1 other")
+	} else if tied > 1 {
+		buf.WriteString(fmt.Sprintf(", tied with %d others", tied))
+	}
+	buf.WriteString(".")
+
+	denom := c.plus.denominationEquivalent(channel, count)
+	if denom != "" {
+		buf.WriteString(fmt.Sprintf("\n\nThat's equivalent to %s", denom))
+	}
+
+	return buf.String(), nil
+}
+
+func (c *PlusLeaderboardCommand) GetSyntax() string {
+	return c.prefix + "++top|--bottom [count] or " + c.prefix + "rank <target>"
+}
+
+func (c *PlusLeaderboardCommand) GetDescription() string {
+	return "Shows who has the most or fewest pluses, or where a single target ranks"
+}
+
+func (c *PlusLeaderboardCommand) Close() {
+	c.rank.Close()
+	c.bottom.Close()
+	c.top.Close()
+}
+
+// The plus command is needed to resolve targets and work out their
+// denomination equivalent the same way pluses do.
+func NewPlusLeaderboardCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusLeaderboardCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(\+\+top|\-\-bottom|rank)(?: +([\w@<>\|#]+))? *$`)
+
+	//A target's rank is one more than the number of targets ahead of it
+	top, err := db.Prepare("SELECT target, count, (SELECT COUNT(*) FROM pluses p WHERE p.count > pluses.count) + 1 FROM pluses ORDER BY count DESC, target")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus top select")
+		return nil
+	}
+
+	bottom, err := db.Prepare("SELECT target, count, (SELECT COUNT(*) FROM pluses p WHERE p.count > pluses.count) + 1 FROM pluses ORDER BY count ASC, target")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus bottom select")
+		return nil
+	}
+
+	rank, err := db.Prepare(`SELECT count,
+		(SELECT COUNT(*) FROM pluses p WHERE p.count > pluses.count) + 1,
+		(SELECT COUNT(*) FROM pluses p WHERE p.count = pluses.count) - 1,
+		(SELECT COUNT(*) FROM pluses)
+		FROM pluses WHERE target=?`)
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus rank select")
+		return nil
+	}
+
+	return &PlusLeaderboardCommand{chat, cfg.Prefix, plus, exp, top, bottom, rank}
+}
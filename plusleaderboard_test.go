@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlusLeaderboardTies(t *testing.T) {
+	bot := newTestBot(t, nil)
+
+	//One clear leader and then a tie far longer than any list
+	_, err := bot.db.Exec("INSERT INTO pluses(target, count) VALUES('leader', 5)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 30; i++ {
+		_, err = bot.db.Exec("INSERT INTO pluses(target, count) VALUES(?, 1)", fmt.Sprintf("tied%02d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replies := bot.say(testAliceID, "?++top 1")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "Here's the top 1\n") || strings.Contains(replies[0], "tied") {
+		t.Errorf("expected only the leader, got %q", replies)
+	}
+
+	//Ties carry a list past its size, but only as far as the largest list
+	replies = bot.say(testAliceID, "?++top 2")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], fmt.Sprintf("Here's the top %d\n", maxLeaderboardSize)) ||
+		!strings.Contains(replies[0], "tied23") || strings.Contains(replies[0], "tied24") ||
+		!strings.HasSuffix(replies[0], "```\nand 6 more tied") {
+		t.Errorf("expected the tie to be cut off at %d, got %q", maxLeaderboardSize, replies)
+	}
+}
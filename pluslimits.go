@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A plusRefusal is a friendly explanation of why a plus or minus
+// wasn't recorded. It is sent back to the channel instead of being
+// treated as a failure.
+type plusRefusal string
+
+func (r plusRefusal) Error() string {
+	return string(r)
+}
+
+// PlusLimiter stops people from spamming pluses or minuses. Everything
+// it needs is read back from the plus ledger so limits survive restarts.
+// A limit of zero turns that check off.
+type PlusLimiter struct {
+	cooldown  time.Duration
+	budget    int
+	minuses   int
+	selLast   *sql.Stmt
+	selGiven  *sql.Stmt
+	selRecent *sql.Stmt
+}
+
+// Check returns a plusRefusal if giver shouldn't be allowed to
+// change target's pluses by delta right now. It should be called
+// with the same transaction that records the change. Refusals call
+// the target name so they don't ping anyone.
+func (l *PlusLimiter) Check(tx *sql.Tx, giver string, target string, name string, delta int) error {
+	if l.cooldown > 0 {
+		var last time.Time
+		err := tx.Stmt(l.selLast).QueryRow(giver, target).Scan(&last)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		wait := l.cooldown - time.Since(last)
+		if err == nil && wait > 0 {
+			return plusRefusal(fmt.Sprintf("Easy there, you can change %s's pluses again in %v.", name, wait.Round(time.Second)))
+		}
+	}
+
+	if l.budget > 0 {
+		var given int
+		err := tx.Stmt(l.selGiven).QueryRow(giver).Scan(&given)
+		if err != nil {
+			return err
+		}
+
+		if given >= l.budget {
+			return plusRefusal(fmt.Sprintf("You've used all %d of your pluses for today. Try again later.", l.budget))
+		}
+	}
+
+	if l.minuses > 0 && delta < 0 {
+		rows, err := tx.Stmt(l.selRecent).Query(giver, target, l.minuses)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		streak := 0
+		for rows.Next() {
+			var d int
+			err = rows.Scan(&d)
+			if err != nil {
+				return err
+			}
+
+			if d >= 0 {
+				break
+			}
+			streak++
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if streak >= l.minuses {
+			return plusRefusal(fmt.Sprintf("That's %d minuses in a row for %s from you. Maybe give them a break.", streak, name))
+		}
+	}
+
+	return nil
+}
+
+func (l *PlusLimiter) Close() {
+	l.selRecent.Close()
+	l.selGiven.Close()
+	l.selLast.Close()
+}
+
+func NewPlusLimiter(db *sql.DB, cfg PlusConfig) (*PlusLimiter, error) {
+	selLast, err := db.Prepare("SELECT created_at FROM plus_ledger WHERE giver=? AND target=? ORDER BY id DESC LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+
+	//The budget is a rolling day rather than resetting at midnight
+	selGiven, err := db.Prepare("SELECT COUNT(*) FROM plus_ledger WHERE giver=? AND created_at > datetime('now', '-1 day')")
+	if err != nil {
+		return nil, err
+	}
+
+	selRecent, err := db.Prepare("SELECT delta FROM plus_ledger WHERE giver=? AND target=? ORDER BY id DESC LIMIT ?")
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlusLimiter{
+		cfg.Cooldown.Duration,
+		cfg.DailyBudget,
+		cfg.MaxConsecutiveMinuses,
+		selLast,
+		selGiven,
+		selRecent,
+	}, nil
+}
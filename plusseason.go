@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// How many of the final standings are announced when a season ends
+const plusSeasonAnnounceSize = 5
+
+// How many standings ?++season shows for a past season
+const plusSeasonStandingsSize = 10
+
+// PlusSeasonCommand lets the admin end a season, which archives every
+// target's count under the season's name and starts everyone from zero.
+type PlusSeasonCommand struct {
+	chat       ChatClient
+	prefix     string
+	admin      string
+	plus       *PlusCommand
+	db         *sql.DB
+	exp        *regexp.Regexp
+	selSeason  *sql.Stmt
+	selSeasons *sql.Stmt
+	standings  *sql.Stmt
+	alltime    *sql.Stmt
+}
+
+func (c *PlusSeasonCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusSeasonCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	token := strings.ToLower(vars[1])
+	arg := strings.TrimSpace(vars[2])
+
+	var disp string
+	var err error
+	switch {
+	case token == "++endseason" && arg != "":
+		if msg.User != c.admin {
+			return NewOutgoingMessage("Only the admin can do that.", msg.Channel), nil
+		}
+		disp, err = c.endSeason(ctx, msg.Channel, arg)
+
+	case token == "++season" && arg != "":
+		disp, err = c.getSeasonDisplay(ctx, msg.Channel, arg)
+
+	case token == "++season":
+		disp, err = c.getSeasonsDisplay(ctx)
+
+	case token == "++alltime" && arg != "":
+		disp, err = c.getAlltimeDisplay(ctx, arg)
+
+	default:
+		disp = c.GetSyntax()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOutgoingMessage(disp, msg.Channel), nil
+}
+
+func (c *PlusSeasonCommand) endSeason(ctx context.Context, channel string, name string) (string, error) {
+	var id int64
+	var started, ended time.Time
+	err := c.selSeason.QueryRowContext(ctx, name).Scan(&id, &name, &started, &ended)
+	if err == nil {
+		return fmt.Sprintf("There's already been a season called %s.", name), nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	//A season runs from the end of the last one, or the first plus ever given
+	res, err := tx.Exec(`INSERT INTO plus_seasons(name, started_at, ended_at) VALUES(?,
+		COALESCE((SELECT MAX(ended_at) FROM plus_seasons), (SELECT MIN(created_at) FROM plus_ledger), CURRENT_TIMESTAMP),
+		CURRENT_TIMESTAMP)`, name)
+	if err != nil {
+		return "", err
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("INSERT INTO plus_season_standings(season, target, count) SELECT ?, target, count FROM pluses WHERE count != 0", id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("DELETE FROM pluses")
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	standings, more, err := c.getStandings(ctx, id, plusSeasonAnnounceSize)
+	if err != nil {
+		return "", err
+	}
+
+	if len(standings) == 0 {
+		return fmt.Sprintf("That's the end of %s. Nobody got any pluses, maybe next season.", name), nil
+	}
+
+	title := fmt.Sprintf("That's the end of %s! Everyone starts again from zero. Here's how it finished", name)
+	return getPlusStandingsDisplay(c.plus, channel, title, standings, more), nil
+}
+
+func (c *PlusSeasonCommand) getStandings(ctx context.Context, season int64, size int) ([]plusStanding, int, error) {
+	rows, err := c.standings.QueryContext(ctx, season)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return readPlusStandings(rows, size)
+}
+
+func (c *PlusSeasonCommand) getSeasonDisplay(ctx context.Context, channel string, name string) (string, error) {
+	var id int64
+	var started, ended time.Time
+	err := c.selSeason.QueryRowContext(ctx, name).Scan(&id, &name, &started, &ended)
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("I don't know of a season called %s.", name), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	standings, more, err := c.getStandings(ctx, id, plusSeasonStandingsSize)
+	if err != nil {
+		return "", err
+	}
+
+	dates := fmt.Sprintf("%s ran from %s to %s", name, started.Format("Jan 2 2006"), ended.Format("Jan 2 2006"))
+	if len(standings) == 0 {
+		return dates + " and nobody got any pluses.", nil
+	}
+
+	return getPlusStandingsDisplay(c.plus, channel, dates, standings, more), nil
+}
+
+func (c *PlusSeasonCommand) getSeasonsDisplay(ctx context.Context) (string, error) {
+	rows, err := c.selSeasons.QueryContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	buf := bytes.NewBufferString("Here are the past seasons")
+	found := false
+	for rows.Next() {
+		var name string
+		var started, ended time.Time
+		err = rows.Scan(&name, &started, &ended)
+		if err != nil {
+			return "", err
+		}
+
+		found = true
+		fmt.Fprintf(buf, "\n%s (%s - %s)", name, started.Format("Jan 2 2006"), ended.Format("Jan 2 2006"))
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	if !found {
+		return "There haven't been any seasons yet.", nil
+	}
+
+	return buf.String(), nil
+}
+
+func (c *PlusSeasonCommand) getAlltimeDisplay(ctx context.Context, txt string) (string, error) {
+	target := c.plus.parseTarget(txt)
+	rows, err := c.alltime.QueryContext(ctx, target, target)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	total := 0
+	var parts []string
+	for rows.Next() {
+		var name string
+		var count int
+		err = rows.Scan(&name, &count)
+		if err != nil {
+			return "", err
+		}
+
+		total += count
+		if name == "" {
+			parts = append(parts, fmt.Sprintf("%d this season", count))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d in %s", count, name))
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	if len(parts) == 0 {
+		return fmt.Sprintf("%s hasn't been given any pluses yet.", txt), nil
+	}
+
+	return fmt.Sprintf("%s has %s all time (%s).", txt, c.plus.pluralize(total, "plus"), strings.Join(parts, ", ")), nil
+}
+
+func (c *PlusSeasonCommand) GetSyntax() string {
+	return c.prefix + "++season [name], " + c.prefix + "++alltime <target> or " + c.prefix + "++endseason <name>"
+}
+
+func (c *PlusSeasonCommand) GetDescription() string {
+	return "Look back at past plus seasons or a target's lifetime total. Only the admin can end a season"
+}
+
+func (c *PlusSeasonCommand) Close() {
+	c.alltime.Close()
+	c.standings.Close()
+	c.selSeasons.Close()
+	c.selSeason.Close()
+}
+
+func NewPlusSeasonCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusSeasonCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(\+\+season|\+\+endseason|\+\+alltime)(?:\s+(.*))?$`)
+
+	selSeason, err := db.Prepare("SELECT id, name, started_at, ended_at FROM plus_seasons WHERE name=?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus season select")
+		return nil
+	}
+
+	selSeasons, err := db.Prepare("SELECT name, started_at, ended_at FROM plus_seasons ORDER BY id DESC")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus seasons select")
+		return nil
+	}
+
+	standings, err := db.Prepare("SELECT target, count, (SELECT COUNT(*) FROM plus_season_standings p WHERE p.season = s.season AND p.count > s.count) + 1 FROM plus_season_standings s WHERE season=? ORDER BY count DESC, target")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus season standings select")
+		return nil
+	}
+
+	alltime, err := db.Prepare(`SELECT '', count FROM pluses WHERE target=? AND count != 0
+		UNION ALL
+		SELECT name, count FROM plus_season_standings JOIN plus_seasons ON plus_seasons.id = season WHERE target=?`)
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus alltime select")
+		return nil
+	}
+
+	return &PlusSeasonCommand{chat, cfg.Prefix, cfg.Admin, plus, db, exp, selSeason, selSeasons, standings, alltime}
+}
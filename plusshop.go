@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var plusShopMigrations = []Migration{
+	{1, "create plus shop", execMigration(
+		//A NULL stock never runs out
+		"CREATE TABLE IF NOT EXISTS plus_shop_items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE COLLATE NOCASE, cost INTEGER NOT NULL, stock INTEGER)",
+		"CREATE TABLE IF NOT EXISTS plus_shop_purchases (id INTEGER PRIMARY KEY AUTOINCREMENT, item INTEGER NOT NULL, name TEXT NOT NULL, buyer TEXT NOT NULL, cost INTEGER NOT NULL, channel TEXT NOT NULL, timestamp TEXT NOT NULL, created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, refunded_at DATETIME)",
+		"CREATE INDEX IF NOT EXISTS plus_shop_purchases_buyer_idx ON plus_shop_purchases (buyer)",
+	)},
+	{2, "record plus shop purchase seasons", execMigration(
+		//The id of the last season to end before the purchase, 0 for the first season
+		"ALTER TABLE plus_shop_purchases ADD COLUMN season INTEGER NOT NULL DEFAULT 0",
+		"UPDATE plus_shop_purchases SET season = COALESCE((SELECT MAX(id) FROM plus_seasons WHERE ended_at <= plus_shop_purchases.created_at), 0)",
+	)},
+}
+
+// PlusShopCommand lets people spend their pluses on things the admin
+// puts up for sale. With the wallet on, buying and refunding go through
+// plus transfers so they come out of the buyer's balance. Otherwise
+// buyers spend this season's count, less what they've already bought
+// this season. Either way counts are never changed, so spending doesn't
+// lower anyone's standing.
+type PlusShopCommand struct {
+	chat     ChatClient
+	prefix   string
+	admin    string
+	plus     *PlusCommand
+	db       *sql.DB
+	exp      *regexp.Regexp
+	ins      *sql.Stmt
+	selID    *sql.Stmt
+	selName  *sql.Stmt
+	selItems *sql.Stmt
+	selSpent *sql.Stmt
+}
+
+func (c *PlusShopCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusShopCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	token := strings.ToLower(vars[1])
+	arg := strings.TrimSpace(vars[2])
+
+	if token == "buy" {
+		if arg == "" {
+			return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+		}
+
+		//Names are stored with single spaces, see add
+		disp, err := c.buy(ctx, msg, strings.Join(strings.Fields(arg), " "))
+		return c.reply(msg, disp, err)
+	}
+
+	if arg == "" {
+		disp, err := c.getItemsDisplay(ctx)
+		return NewOutgoingMessage(disp, msg.Channel), err
+	}
+
+	if msg.User != c.admin {
+		return NewOutgoingMessage("Only the admin can do that.", msg.Channel), nil
+	}
+
+	//Item names can have spaces in them, the count for stock is always last
+	args := strings.Fields(arg)
+	var disp string
+	var err error
+	switch {
+	case strings.ToLower(args[0]) == "add" && len(args) >= 3:
+		cost, convErr := strconv.Atoi(args[1])
+		if convErr != nil || cost < 1 {
+			disp = c.GetSyntax()
+			break
+		}
+		disp, err = c.add(ctx, cost, strings.Join(args[2:], " "))
+
+	case strings.ToLower(args[0]) == "stock" && len(args) >= 3:
+		disp, err = c.stock(ctx, strings.Join(args[1:len(args)-1], " "), strings.ToLower(args[len(args)-1]))
+
+	case strings.ToLower(args[0]) == "remove" && len(args) >= 2:
+		disp, err = c.remove(ctx, strings.Join(args[1:], " "))
+
+	case strings.ToLower(args[0]) == "refund" && len(args) == 2:
+		disp, err = c.refund(ctx, msg, args[1])
+
+	default:
+		disp = c.GetSyntax()
+	}
+
+	return c.reply(msg, disp, err)
+}
+
+// Sends a plusRefusal back as a reply instead of treating it as an error
+func (c *PlusShopCommand) reply(msg *Message, disp string, err error) (*OutgoingMessage, error) {
+	if refusal, ok := err.(plusRefusal); ok {
+		return NewOutgoingMessage(string(refusal), msg.Channel), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewOutgoingMessage(disp, msg.Channel), nil
+}
+
+func (c *PlusShopCommand) buy(ctx context.Context, msg *Message, txt string) (string, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var name string
+	var cost int
+	var stock sql.NullInt64
+	err = c.getItem(ctx, tx, txt).Scan(&id, &name, &cost, &stock)
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("The shop doesn't sell %s.", txt), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if stock.Valid && stock.Int64 < 1 {
+		return fmt.Sprintf("Sorry, %s is sold out.", name), nil
+	}
+
+	buyer := userTarget(msg.User)
+	left, err := c.spend(tx, msg, buyer, cost, "bought "+name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("UPDATE plus_shop_items SET stock = stock - 1 WHERE id=? AND stock IS NOT NULL", id)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := tx.Stmt(c.ins).Exec(id, name, buyer, cost, msg.Channel, msg.Timestamp)
+	if err != nil {
+		return "", err
+	}
+
+	purchase, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"purchase": purchase,
+		"item":     name,
+		"cost":     cost,
+		"user":     msg.User,
+		"channel":  msg.Channel,
+	}).Info("plus shop purchase")
+
+	return fmt.Sprintf("%s bought %s for %s (purchase #%d) and has %d left.",
+		c.plus.targetName(buyer), name, c.plus.pluralize(cost, "plus"), purchase, left), nil
+}
+
+// Gives a purchase's pluses back to the buyer and puts the item back in stock
+func (c *PlusShopCommand) refund(ctx context.Context, msg *Message, txt string) (string, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(txt, "#"), 10, 64)
+	if err != nil {
+		return c.GetSyntax(), nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var item int64
+	var name, buyer string
+	var cost int
+	var refunded sql.NullString
+	err = tx.QueryRow("SELECT item, name, buyer, cost, refunded_at FROM plus_shop_purchases WHERE id=?", id).Scan(&item, &name, &buyer, &cost, &refunded)
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("There's no purchase #%d.", id), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if refunded.Valid {
+		return fmt.Sprintf("Purchase #%d has already been refunded.", id), nil
+	}
+
+	_, err = tx.Exec("UPDATE plus_shop_items SET stock = stock + 1 WHERE id=? AND stock IS NOT NULL", item)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("UPDATE plus_shop_purchases SET refunded_at = CURRENT_TIMESTAMP WHERE id=?", id)
+	if err != nil {
+		return "", err
+	}
+
+	var val int
+	if c.plus.wallet {
+		_, val, err = c.plus.transfer(tx, msg, "", buyer, cost, fmt.Sprintf("refund for %s (purchase #%d)", name, id))
+	} else {
+		//Marking it refunded is enough to take it off what was spent
+		val, err = c.spendable(tx, buyer)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"purchase": id,
+		"item":     name,
+		"cost":     cost,
+		"user":     msg.User,
+		"channel":  msg.Channel,
+	}).Info("plus shop refund")
+
+	target := c.plus.targetName(buyer)
+	return fmt.Sprintf("Refunded %s to %s for %s (purchase #%d), %s now has %s.",
+		c.plus.pluralize(cost, "plus"), target, name, id, target, c.plus.pluralize(val, "plus")), nil
+}
+
+// Takes cost from what buyer can spend and returns what's left, or a
+// plusRefusal if they can't afford it. Without the wallet the purchase
+// itself records the spend, so there's nothing to write here.
+func (c *PlusShopCommand) spend(tx *sql.Tx, msg *Message, buyer string, cost int, reason string) (int, error) {
+	if c.plus.wallet {
+		left, _, err := c.plus.transfer(tx, msg, buyer, "", cost, reason)
+		return left, err
+	}
+
+	left, err := c.spendable(tx, buyer)
+	if err != nil {
+		return 0, err
+	}
+
+	if left < cost {
+		return 0, plusRefusal(fmt.Sprintf("You only have %s.", c.plus.pluralize(left, "plus")))
+	}
+
+	return left - cost, nil
+}
+
+// This season's count less the purchases made this season that haven't
+// been refunded
+func (c *PlusShopCommand) spendable(tx *sql.Tx, buyer string) (int, error) {
+	var left int
+	err := tx.Stmt(c.selSpent).QueryRow(buyer, buyer).Scan(&left)
+	return left, err
+}
+
+func (c *PlusShopCommand) add(ctx context.Context, cost int, name string) (string, error) {
+	if _, ok := parseItemID(name); ok {
+		return "Item names can't be numbers, they're how items are bought by number.", nil
+	}
+
+	_, err := c.db.ExecContext(ctx, "INSERT INTO plus_shop_items(name, cost) VALUES(?,?) ON CONFLICT(name) DO UPDATE SET cost = excluded.cost", name, cost)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("OK, %s costs %s.", name, c.plus.pluralize(cost, "plus")), nil
+}
+
+// Sets how many of an item are left, or lets it be bought forever
+func (c *PlusShopCommand) stock(ctx context.Context, txt string, count string) (string, error) {
+	stock := sql.NullInt64{}
+	if count != "unlimited" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return c.GetSyntax(), nil
+		}
+
+		stock = sql.NullInt64{Int64: int64(n), Valid: true}
+	}
+
+	var name string
+	err := c.getItem(ctx, nil, txt).Scan(new(int64), &name, new(int), new(sql.NullInt64))
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("The shop doesn't sell %s.", txt), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	_, err = c.db.ExecContext(ctx, "UPDATE plus_shop_items SET stock=? WHERE name=?", stock, name)
+	if err != nil {
+		return "", err
+	}
+
+	if !stock.Valid {
+		return fmt.Sprintf("OK, %s will never run out.", name), nil
+	}
+
+	return fmt.Sprintf("OK, %s has %d left.", name, stock.Int64), nil
+}
+
+func (c *PlusShopCommand) remove(ctx context.Context, txt string) (string, error) {
+	var name string
+	err := c.getItem(ctx, nil, txt).Scan(new(int64), &name, new(int), new(sql.NullInt64))
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("The shop doesn't sell %s.", txt), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	//Purchases keep their own copy of the name and cost so they can still be refunded
+	_, err = c.db.ExecContext(ctx, "DELETE FROM plus_shop_items WHERE name=?", name)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("OK, the shop no longer sells %s.", name), nil
+}
+
+// Items can be referred to by their number in the shop, like 3 or #3,
+// or otherwise by name. Pass tx to look the item up as part of it.
+func (c *PlusShopCommand) getItem(ctx context.Context, tx *sql.Tx, txt string) *sql.Row {
+	sel, arg := c.selName, interface{}(txt)
+	if id, ok := parseItemID(txt); ok {
+		sel, arg = c.selID, id
+	}
+
+	if tx != nil {
+		sel = tx.Stmt(sel)
+	}
+
+	return sel.QueryRowContext(ctx, arg)
+}
+
+func parseItemID(txt string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(txt, "#"), 10, 64)
+	return id, err == nil
+}
+
+func (c *PlusShopCommand) getItemsDisplay(ctx context.Context) (string, error) {
+	rows, err := c.selItems.QueryContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	buf := bytes.NewBufferString(fmt.Sprintf("Here's what's for sale, `%sbuy <item>` to spend your pluses\n```", c.prefix))
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	found := false
+	for rows.Next() {
+		var id int64
+		var name string
+		var cost int
+		var stock sql.NullInt64
+		err = rows.Scan(&id, &name, &cost, &stock)
+		if err != nil {
+			return "", err
+		}
+
+		found = true
+		left := ""
+		if stock.Valid && stock.Int64 == 0 {
+			left = "sold out"
+		} else if stock.Valid {
+			left = fmt.Sprintf("%d left", stock.Int64)
+		}
+
+		fmt.Fprintf(w, "#%d\t%s\t%s\t%s\n", id, name, c.plus.pluralize(cost, "plus"), left)
+	}
+	fmt.Fprint(w, "```")
+	w.Flush()
+
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	if !found {
+		return "The shop doesn't have anything for sale yet.", nil
+	}
+
+	return buf.String(), nil
+}
+
+func (c *PlusShopCommand) GetSyntax() string {
+	return c.prefix + "shop, " + c.prefix + "buy <item> or " + c.prefix + "shop add <cost> <name>|stock <item> <count|unlimited>|remove <item>|refund <purchase>"
+}
+
+func (c *PlusShopCommand) GetDescription() string {
+	return "Spend your pluses on things in the shop. Only the admin can stock the shop or give refunds"
+}
+
+func (c *PlusShopCommand) Close() {
+	c.selSpent.Close()
+	c.selItems.Close()
+	c.selName.Close()
+	c.selID.Close()
+	c.ins.Close()
+}
+
+func NewPlusShopCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusShopCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(shop|buy)(?:\s+(.*))?$`)
+
+	ins, err := db.Prepare("INSERT INTO plus_shop_purchases(item, name, buyer, cost, channel, timestamp, season) VALUES(?,?,?,?,?,?, COALESCE((SELECT MAX(id) FROM plus_seasons), 0))")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus shop purchase insert")
+		return nil
+	}
+
+	selID, err := db.Prepare("SELECT id, name, cost, stock FROM plus_shop_items WHERE id=?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus shop item id select")
+		return nil
+	}
+
+	selName, err := db.Prepare("SELECT id, name, cost, stock FROM plus_shop_items WHERE name=?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus shop item name select")
+		return nil
+	}
+
+	selItems, err := db.Prepare("SELECT id, name, cost, stock FROM plus_shop_items ORDER BY cost, name")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus shop items select")
+		return nil
+	}
+
+	selSpent, err := db.Prepare(`SELECT COALESCE((SELECT count FROM pluses WHERE target=?), 0) - COALESCE((SELECT SUM(cost) FROM plus_shop_purchases
+		WHERE buyer=? AND refunded_at IS NULL AND season = COALESCE((SELECT MAX(id) FROM plus_seasons), 0)), 0)`)
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus shop spendable select")
+		return nil
+	}
+
+	return &PlusShopCommand{chat, cfg.Prefix, cfg.Admin, plus, db, exp, ins, selID, selName, selItems, selSpent}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlusShopDisabledByDefault(t *testing.T) {
+	bot := newTestBot(t, nil)
+
+	replies := bot.say(testAliceID, "?shop")
+	if len(replies) != 0 {
+		t.Errorf("expected no shop by default, got %q", replies)
+	}
+}
+
+func TestPlusShopAcrossSeasons(t *testing.T) {
+	bot := newTestBot(t, func(cfg *Config) {
+		enablePlusWallet(cfg)
+		cfg.Commands.PlusShop.Enabled = true
+	})
+
+	bot.expect(testAdminID, "?shop add 3 coffee", "OK, coffee costs 3 pluses.")
+	bot.expect(testAdminID, "?mint <@UALICE> 5", "Minted 5 pluses for alice, alice now has 5 pluses.")
+	bot.expect(testAliceID, "?buy coffee", "alice bought coffee for 3 pluses (purchase #1) and has 2 left.")
+	bot.expect(testBobID, "?++ <@UALICE>", "bob gave a plus to <@UALICE>, <@UALICE> now has 1 plus.")
+
+	replies := bot.say(testAdminID, "?++endseason Spring")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "That's the end of Spring!") {
+		t.Fatalf("expected the season to end, got %q", replies)
+	}
+
+	bot.expect(testAdminID, "?shop refund #1", "Refunded 3 pluses to alice for coffee (purchase #1), alice now has 5 pluses.")
+	bot.expect(testAliceID, "?buy coffee", "alice bought coffee for 3 pluses (purchase #2) and has 2 left.")
+	bot.expect(testAliceID, "?buy coffee", "You only have 2 pluses.")
+	//What alice spent came out of the balance, not the new season's count
+	bot.expect(testBobID, "?++ <@UALICE>", "bob gave a plus to <@UALICE>, <@UALICE> now has 1 plus.")
+}
+
+func TestPlusShopItems(t *testing.T) {
+	bot := newTestBot(t, func(cfg *Config) {
+		enablePlusWallet(cfg)
+		cfg.Commands.PlusShop.Enabled = true
+	})
+
+	bot.expect(testAdminID, "?shop add  5   big   mug", "OK, big mug costs 5 pluses.")
+	bot.expect(testAdminID, "?shop add 2 tea", "OK, tea costs 2 pluses.")
+	bot.expect(testAdminID, "?shop add 2 #1", "Item names can't be numbers, they're how items are bought by number.")
+	bot.expect(testAliceID, "?shop add 1 cake", "Only the admin can do that.")
+
+	bot.expect(testAdminID, "?shop stock  big mug   1", "OK, big mug has 1 left.")
+	bot.expect(testAdminID, "?shop stock #2 unlimited", "OK, tea will never run out.")
+
+	bot.expect(testAdminID, "?mint <@UALICE> 10", "Minted 10 pluses for alice, alice now has 10 pluses.")
+	bot.expect(testAliceID, "?buy 1", "alice bought big mug for 5 pluses (purchase #1) and has 5 left.")
+	bot.expect(testAliceID, "?buy big  mug", "Sorry, big mug is sold out.")
+	bot.expect(testAliceID, "?buy #2", "alice bought tea for 2 pluses (purchase #2) and has 3 left.")
+	bot.expect(testAliceID, "?buy 3", "The shop doesn't sell 3.")
+
+	bot.expect(testAdminID, "?shop remove   big mug", "OK, the shop no longer sells big mug.")
+	bot.expect(testAliceID, "?buy big mug", "The shop doesn't sell big mug.")
+}
+
+func TestPlusShopSpendsCount(t *testing.T) {
+	bot := newTestBot(t, func(cfg *Config) {
+		noPlusCooldown(cfg)
+		cfg.Commands.PlusShop.Enabled = true
+	})
+
+	bot.expect(testAdminID, "?shop add 2 coffee", "OK, coffee costs 2 pluses.")
+	bot.expect(testBobID, "?++ <@UALICE>", "bob gave a plus to <@UALICE>, <@UALICE> now has 1 plus.")
+	bot.expect(testBobID, "?++ <@UALICE>", "bob gave a plus to <@UALICE>, <@UALICE> now has 2 pluses.")
+	bot.expect(testBobID, "?++ <@UALICE>", "bob gave a plus to <@UALICE>, <@UALICE> now has 3 pluses.")
+
+	bot.expect(testAliceID, "?buy coffee", "alice bought coffee for 2 pluses (purchase #1) and has 1 left.")
+	bot.expect(testAliceID, "?buy coffee", "You only have 1 plus.")
+
+	//Spending doesn't change anyone's standing
+	replies := bot.say(testAliceID, "?++top")
+	if len(replies) != 1 || !strings.Contains(replies[0], "alice  3 pluses") {
+		t.Errorf("expected alice to still have 3 pluses, got %q", replies)
+	}
+
+	bot.expect(testAdminID, "?shop refund #1", "Refunded 2 pluses to alice for coffee (purchase #1), alice now has 3 pluses.")
+	bot.expect(testAliceID, "?buy coffee", "alice bought coffee for 2 pluses (purchase #2) and has 1 left.")
+
+	replies = bot.say(testAdminID, "?++endseason Spring")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "That's the end of Spring!") {
+		t.Fatalf("expected the season to end, got %q", replies)
+	}
+
+	//A new season starts everyone from zero, purchases included
+	bot.expect(testAliceID, "?buy coffee", "You only have 0 pluses.")
+	bot.expect(testBobID, "?++ <@UALICE>", "bob gave a plus to <@UALICE>, <@UALICE> now has 1 plus.")
+	bot.expect(testAliceID, "?buy coffee", "You only have 1 plus.")
+}
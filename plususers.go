@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the user list is trusted before it is fetched again
+const plusUserCacheTTL = 10 * time.Minute
+
+// PlusUsers remembers who is in slack so plain names like "alice" can
+// be recognised as people, and stored targets can be shown by name
+// without a lookup for every leaderboard row. The list is fetched again
+// once it is stale, which picks up renames and new people.
+type PlusUsers struct {
+	chat    ChatClient
+	mu      sync.Mutex
+	names   map[string]string //Name by id
+	ids     map[string]string //Id by lower case name
+	fetched time.Time
+}
+
+// Name returns the current name of the user with id
+func (u *PlusUsers) Name(id string) (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.refresh()
+	if name, ok := u.names[id]; ok {
+		return name, true
+	}
+
+	//Someone who joined since the list was fetched
+	user, err := u.chat.GetUserInfo(id)
+	if err != nil {
+		return "", false
+	}
+
+	u.add(user.ID, user.Name)
+	return user.Name, true
+}
+
+// ID returns the id of the user called name, ignoring case
+func (u *PlusUsers) ID(name string) (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.refresh()
+	id, ok := u.ids[strings.ToLower(name)]
+	return id, ok
+}
+
+// Must be called with mu held
+func (u *PlusUsers) refresh() {
+	if time.Since(u.fetched) < plusUserCacheTTL {
+		return
+	}
+
+	//Even on failure, so a chat outage doesn't mean a request per lookup
+	u.fetched = time.Now()
+
+	users, err := u.chat.ListUsers()
+	if err != nil {
+		logger.WithError(err).Error("error listing users")
+		return
+	}
+
+	u.names = make(map[string]string, len(users))
+	u.ids = make(map[string]string, len(users))
+	for _, user := range users {
+		u.add(user.ID, user.Name)
+	}
+}
+
+func (u *PlusUsers) add(id string, name string) {
+	u.names[id] = name
+	u.ids[strings.ToLower(name)] = id
+}
+
+func NewPlusUsers(chat ChatClient) *PlusUsers {
+	return &PlusUsers{
+		chat:  chat,
+		names: make(map[string]string),
+		ids:   make(map[string]string),
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How many recent transfers ?balance lists
+const plusWalletHistorySize = 5
+
+// PlusWalletCommand lets people spend their balance of pluses. Giving
+// moves pluses from one user to another rather than making new ones,
+// and only the admin can mint more. Every transfer is kept in
+// plus_transfers and none of them change anyone's standing.
+type PlusWalletCommand struct {
+	chat    ChatClient
+	prefix  string
+	admin   string
+	plus    *PlusCommand
+	db      *sql.DB
+	exp     *regexp.Regexp
+	argExp  *regexp.Regexp
+	balance *sql.Stmt
+	history *sql.Stmt
+}
+
+func (c *PlusWalletCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusWalletCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	token := strings.ToLower(vars[1])
+
+	if token == "balance" {
+		disp, err := c.getBalanceDisplay(ctx, msg.Channel, userTarget(msg.User))
+		if err != nil {
+			return nil, err
+		}
+
+		return NewOutgoingMessage(disp, msg.Channel), nil
+	}
+
+	args := c.argExp.FindStringSubmatch(strings.TrimSpace(vars[2]))
+	if args == nil {
+		return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+	}
+
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount < 1 {
+		return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+	}
+
+	recipient := c.plus.parseTarget(args[1])
+	if !userTargetExp.MatchString(recipient) {
+		return NewOutgoingMessage("Pluses can only be given to people, try @mentioning them.", msg.Channel), nil
+	}
+
+	sender := userTarget(msg.User)
+	if token == "mint" {
+		if msg.User != c.admin {
+			return NewOutgoingMessage("Only the admin can do that.", msg.Channel), nil
+		}
+
+		sender = ""
+	} else if recipient == sender {
+		return NewOutgoingMessage("You can't give pluses to yourself.", msg.Channel), nil
+	}
+
+	disp, err := c.transfer(ctx, msg, sender, recipient, amount, strings.TrimSpace(args[3]))
+	if refusal, ok := err.(plusRefusal); ok {
+		return NewOutgoingMessage(string(refusal), msg.Channel), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewOutgoingMessage(disp, msg.Channel), nil
+}
+
+// Moves amount from sender to recipient, or mints it if there is no
+// sender. Returns a plusRefusal if the sender can't afford it.
+func (c *PlusWalletCommand) transfer(ctx context.Context, msg *Message, sender string, recipient string, amount int, reason string) (string, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	left, val, err := c.plus.transfer(tx, msg, sender, recipient, amount, reason)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	name := c.plus.targetName(recipient)
+	if reason != "" {
+		reason = " " + reason
+	}
+
+	if sender == "" {
+		return fmt.Sprintf("Minted %s for %s%s, %s now has %s.", c.plus.pluralize(amount, "plus"), name, reason, name, c.plus.pluralize(val, "plus")), nil
+	}
+
+	return fmt.Sprintf("%s gave %s to %s%s, %s now has %s and %s has %d left.",
+		c.plus.targetName(sender), c.plus.pluralize(amount, "plus"), name, reason, name, c.plus.pluralize(val, "plus"), c.plus.targetName(sender), left), nil
+}
+
+func (c *PlusWalletCommand) getBalanceDisplay(ctx context.Context, channel string, target string) (string, error) {
+	var bal int
+	err := c.balance.QueryRowContext(ctx, target).Scan(&bal)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf("You have %s.", c.plus.pluralize(bal, "plus")))
+	denom := c.plus.denominationEquivalent(channel, bal)
+	if denom != "" {
+		buf.WriteString(fmt.Sprintf("\n\nThat's equivalent to %s", denom))
+	}
+
+	rows, err := c.history.QueryContext(ctx, target, target, plusWalletHistorySize)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var sender, recipient, reason string
+		var amount int
+		var created time.Time
+		err = rows.Scan(&sender, &recipient, &amount, &reason, &created)
+		if err != nil {
+			return "", err
+		}
+
+		if !found {
+			buf.WriteString("\n\nRecent transfers")
+			found = true
+		}
+
+		switch {
+		case sender == "":
+			fmt.Fprintf(buf, "\n%+d minted on %s", amount, created.Format("Jan 2"))
+		case recipient == "":
+			fmt.Fprintf(buf, "\n%+d spent on %s", -amount, created.Format("Jan 2"))
+		case sender == target:
+			fmt.Fprintf(buf, "\n%+d to %s on %s", -amount, c.plus.targetName(recipient), created.Format("Jan 2"))
+		default:
+			fmt.Fprintf(buf, "\n%+d from %s on %s", amount, c.plus.targetName(sender), created.Format("Jan 2"))
+		}
+
+		if reason != "" {
+			buf.WriteString(": " + reason)
+		}
+	}
+
+	return buf.String(), rows.Err()
+}
+
+func (c *PlusWalletCommand) GetSyntax() string {
+	return c.prefix + "give <user> <count> [reason], " + c.prefix + "balance or " + c.prefix + "mint <user> <count> [reason]"
+}
+
+func (c *PlusWalletCommand) GetDescription() string {
+	return "Spend your own pluses by giving them to someone else. Only the admin can mint new ones"
+}
+
+func (c *PlusWalletCommand) Close() {
+	c.history.Close()
+	c.balance.Close()
+}
+
+func NewPlusWalletCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusWalletCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(give|balance|mint)(?:\s+(.*))?$`)
+	argExp := regexp.MustCompile(`^([\w@<>\|#]+)\s+(\d+)(.*)$`)
+
+	balance, err := db.Prepare("SELECT balance FROM plus_balances WHERE target=?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus balance select")
+		return nil
+	}
+
+	history, err := db.Prepare("SELECT sender, recipient, amount, reason, created_at FROM plus_transfers WHERE sender=? OR recipient=? ORDER BY id DESC LIMIT ?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus transfer select")
+		return nil
+	}
+
+	return &PlusWalletCommand{chat, cfg.Prefix, cfg.Admin, plus, db, exp, argExp, balance, history}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Turns the wallet on along with plus_wallet's usual settings
+func enablePlusWallet(cfg *Config) {
+	noPlusCooldown(cfg)
+	cfg.Commands.PlusWallet.Enabled = true
+}
+
+func TestPlusWalletTransfers(t *testing.T) {
+	bot := newTestBot(t, enablePlusWallet)
+
+	bot.expect(testAliceID, "?mint <@UALICE> 5", "Only the admin can do that.")
+	bot.expect(testAdminID, "?mint <@UALICE> 10 to start", "Minted 10 pluses for alice to start, alice now has 10 pluses.")
+	bot.expect(testAliceID, "?give <@UBOB> 3 for lunch", "alice gave 3 pluses to bob for lunch, bob now has 3 pluses and alice has 7 left.")
+	bot.expect(testBobID, "?give <@UALICE> 4", "You only have 3 pluses.")
+	bot.expect(testAliceID, "?give <@UALICE> 1", "You can't give pluses to yourself.")
+}
+
+func TestPlusWalletIgnoresPluses(t *testing.T) {
+	bot := newTestBot(t, enablePlusWallet)
+
+	bot.expect(testAdminID, "?mint <@UBOB> 2", "Minted 2 pluses for bob, bob now has 2 pluses.")
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.")
+	bot.expect(testAliceID, "?-- <@UBOB>", "alice took a plus from <@UBOB>, <@UBOB> now has 0 pluses.")
+	bot.expect(testAliceID, "?-- <@UBOB>", "alice took a plus from <@UBOB>, <@UBOB> now has -1 pluses.")
+
+	//Only the admin mints, so none of that changed what bob can spend
+	replies := bot.say(testBobID, "?balance")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "You have 2 pluses.") {
+		t.Errorf("expected bob's balance to be untouched, got %q", replies)
+	}
+
+	replies = bot.say(testAliceID, "?balance")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "You have 0 pluses.") {
+		t.Errorf("expected alice to have nothing to spend, got %q", replies)
+	}
+}
+
+func TestPlusWalletSurvivesSeasons(t *testing.T) {
+	bot := newTestBot(t, enablePlusWallet)
+
+	bot.expect(testAdminID, "?mint <@UALICE> 10", "Minted 10 pluses for alice, alice now has 10 pluses.")
+	bot.expect(testAliceID, "?give <@UBOB> 3", "alice gave 3 pluses to bob, bob now has 3 pluses and alice has 7 left.")
+	//Transfers move balances, not standings
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.")
+
+	replies := bot.say(testAdminID, "?++endseason Spring")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "That's the end of Spring!") {
+		t.Fatalf("expected the season to end, got %q", replies)
+	}
+
+	replies = bot.say(testAliceID, "?balance")
+	if len(replies) != 1 || !strings.HasPrefix(replies[0], "You have 7 pluses.") {
+		t.Errorf("expected alice's balance to carry over, got %q", replies)
+	}
+
+	bot.expect(testBobID, "?give <@UALICE> 2", "bob gave 2 pluses to alice, alice now has 9 pluses and bob has 1 left.")
+	//Giving away an old balance doesn't touch the new season's standing
+	bot.expect(testAliceID, "?++ <@UBOB>", "alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.")
+}
+
+func TestPlusBalanceMigration(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	//The plus migrations from before balances had a table of their own
+	err := NewMigrator(db, []MigrationSet{{"plus", plusMigrations[:7]}}).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		"INSERT INTO pluses (target, count) VALUES ('<@UALICE>', 6), ('<@UBOB>', 4)",
+		"INSERT INTO plus_transfers (id, sender, recipient, amount, issuer, channel, timestamp, reason) VALUES (1, '', '<@UALICE>', 5, 'UADMIN', 'C', '1', ''), (2, '<@UALICE>', '<@UBOB>', 2, 'UALICE', 'C', '2', '')",
+		//Transfers used to be in the ledger and in the counts
+		`INSERT INTO plus_ledger (giver, target, delta, channel, timestamp, reason, transfer) VALUES
+			('', '<@UALICE>', 5, 'C', '1', '', 1),
+			('UALICE', '<@UALICE>', -2, 'C', '2', '', 2),
+			('UALICE', '<@UBOB>', 2, 'C', '2', '', 2),
+			('UALICE', '<@UBOB>', 2, 'C', '3', '', NULL),
+			('UBOB', '<@UALICE>', 3, 'C', '4', '', NULL)`,
+	} {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = NewMigrator(db, schemaMigrations).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for target, want := range map[string][2]int{"<@UALICE>": {3, 6}, "<@UBOB>": {2, 4}} {
+		var count, balance int
+		err = db.QueryRow("SELECT count, (SELECT balance FROM plus_balances WHERE target=?) FROM pluses WHERE target=?", target, target).Scan(&count, &balance)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != want[0] || balance != want[1] {
+			t.Errorf("%s has a count of %d and a balance of %d, want %d and %d", target, count, balance, want[0], want[1])
+		}
+	}
+
+	var transfers int
+	err = db.QueryRow("SELECT COUNT(*) FROM plus_ledger WHERE transfer IS NOT NULL").Scan(&transfers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if transfers != 0 {
+		t.Errorf("expected transfers to be gone from the ledger, %d are left", transfers)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// How many reasons ?why lists
+const plusWhyLimit = 5
+
+type PlusWhyCommand struct {
+	chat   ChatClient
+	prefix string
+	plus   *PlusCommand
+	exp    *regexp.Regexp
+	sel    *sql.Stmt
+}
+
+func (c *PlusWhyCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
+
+func (c *PlusWhyCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	if vars[1] == "" {
+		return NewOutgoingMessage(c.GetSyntax(), msg.Channel), nil
+	}
+
+	target := c.plus.parseTarget(vars[1])
+	rows, err := c.sel.QueryContext(ctx, target, plusWhyLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buf := bytes.NewBufferString(fmt.Sprintf("Here's why %s has pluses", vars[1]))
+	found := false
+	for rows.Next() {
+		var giver, reason string
+		var delta int
+		var created time.Time
+		err = rows.Scan(&giver, &delta, &reason, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		found = true
+		fmt.Fprintf(buf, "\n%+d from %s on %s: %s", delta, c.getName(giver), created.Format("Jan 2"), reason)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return NewOutgoingMessage(fmt.Sprintf("Nobody has said why %s has pluses.", vars[1]), msg.Channel), nil
+	}
+
+	return NewOutgoingMessage(buf.String(), msg.Channel), nil
+}
+
+// Givers are stored by user id so show their current name when we can
+func (c *PlusWhyCommand) getName(id string) string {
+	user, err := c.chat.GetUserInfo(id)
+	if err != nil {
+		return id
+	}
+
+	return user.Name
+}
+
+func (c *PlusWhyCommand) GetSyntax() string {
+	return c.prefix + "why <target>"
+}
+
+func (c *PlusWhyCommand) GetDescription() string {
+	return "Shows the most recent reasons a target was given or lost pluses"
+}
+
+func (c *PlusWhyCommand) Close() {
+	c.sel.Close()
+}
+
+func NewPlusWhyCommand(chat ChatClient, db *sql.DB, plus *PlusCommand, cfg CommandConfig) *PlusWhyCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `why(?: +([\w@<>\|#]+))? *$`)
+
+	sel, err := db.Prepare("SELECT giver, delta, reason, created_at FROM plus_ledger WHERE target=? AND reason != '' ORDER BY id DESC LIMIT ?")
+	if err != nil {
+		logger.WithError(err).Error("error preparing plus why select")
+		return nil
+	}
+
+	return &PlusWhyCommand{chat, cfg.Prefix, plus, exp, sel}
+}
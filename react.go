@@ -1,56 +1,65 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/nlopes/slack"
 	"regexp"
 	"strings"
 )
 
-type ReactCommand struct {
-	rtm *slack.RTM
-	exp *regexp.Regexp
-	ins *sql.Stmt
-	del *sql.Stmt
-	sel *sql.Stmt
+var reactMigrations = []Migration{
+	{1, "create reactions", execMigration(
+		"CREATE TABLE IF NOT EXISTS reactions (target TEXT NOT NULL, emoji TEXT NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS reactions_target_idx ON reactions (target)",
+		"CREATE INDEX IF NOT EXISTS reactions_target_emoji_idx ON reactions (target, emoji)",
+	)},
 }
 
-func (c *ReactCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return true, true
+type ReactCommand struct {
+	chat   ChatClient
+	prefix string
+	exp    *regexp.Regexp
+	ins    *sql.Stmt
+	del    *sql.Stmt
+	sel    *sql.Stmt
 }
 
-func (c *ReactCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
-	msgRef := slack.NewRefToMessage(msg.Channel, msg.Timestamp)
-
-	if c.exp.MatchString(msg.Text) {
-		vars := c.exp.FindStringSubmatch(msg.Text)
-		target := strings.ToLower(parseUsernamesAndChannels(&c.rtm.Client, strings.TrimSpace(vars[3])))
-		dbCmd := c.ins
-		out := c.rtm.NewOutgoingMessage("Got it.", msg.Channel)
-		if vars[1] == "unreact" {
-			dbCmd = c.del
-			out.Text = fmt.Sprintf("Removed :%s: reaction", vars[2])
-		}
+func (c *ReactCommand) Matches(msg *Message) bool {
+	return c.exp.MatchString(msg.Text)
+}
 
-		_, err := dbCmd.Exec(target, vars[2])
-		if err != nil {
-			return nil, err
-		}
+func (c *ReactCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	vars := c.exp.FindStringSubmatch(msg.Text)
+	target := strings.ToLower(parseUsernamesAndChannels(c.chat, strings.TrimSpace(vars[3])))
+	dbCmd := c.ins
+	out := NewOutgoingMessage("Got it.", msg.Channel)
+	if vars[1] == "unreact" {
+		dbCmd = c.del
+		out.Text = fmt.Sprintf("Removed :%s: reaction", vars[2])
+	}
 
-		return out, nil
+	_, err := dbCmd.Exec(target, vars[2])
+	if err != nil {
+		return nil, err
 	}
 
-	txt := strings.ToLower(parseUsernamesAndChannels(&c.rtm.Client, strings.TrimSpace(msg.Text)))
+	return out, nil
+}
+
+// Listen adds reactions to any message containing a phrase that has been
+// set up with ?react
+func (c *ReactCommand) Listen(ctx context.Context, msg *Message) error {
+	txt := strings.ToLower(parseUsernamesAndChannels(c.chat, strings.TrimSpace(msg.Text)))
 	if len(txt) < 1 {
-		return nil, nil
+		return nil
 	}
 
-	rows, err := c.sel.Query()
+	rows, err := c.sel.QueryContext(ctx)
 	if err != nil {
-		rows.Close()
-		return nil, err
+		return err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var emoji, target string
@@ -59,17 +68,18 @@ func (c *ReactCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
 		}
 
 		if strings.Contains(txt, target) {
-			c.rtm.AddReaction(emoji, msgRef)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.chat.AddReaction(emoji, msg.Channel, msg.Timestamp)
 		}
 	}
 
-	rows.Close()
-
-	return nil, nil
+	return nil
 }
 
 func (c *ReactCommand) GetSyntax() string {
-	return "?(un)react <emoji> to <string>"
+	return c.prefix + "(un)react <emoji> to <string>"
 }
 
 func (c *ReactCommand) GetDescription() string {
@@ -82,30 +92,26 @@ func (c *ReactCommand) Close() {
 	c.ins.Close()
 }
 
-func NewReactCommand(rtm *slack.RTM, db *sql.DB) *ReactCommand {
-	exp := regexp.MustCompile(`^(?i)\?(react|unreact) :(\w+?): to (.+?)$`)
-
-	db.Exec("CREATE TABLE reactions (target TEXT NOT NULL, emoji TEXT NOT NULL)")
-	db.Exec("CREATE INDEX target_idx IF NOT EXISTS ON reactions (target)")
-	db.Exec("CREATE INDEX target_emoji_idx IF NOT EXISTS ON reactions (target, emoji)")
+func NewReactCommand(chat ChatClient, db *sql.DB, cfg CommandConfig) *ReactCommand {
+	exp := regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(cfg.Prefix) + `(react|unreact) :(\w+?): to (.+?)$`)
 
 	ins, err := db.Prepare("INSERT INTO reactions(target, emoji) VALUES(?,?)")
 	if err != nil {
-		fmt.Printf("error preparing reactions insert: %v\n", err)
+		logger.WithError(err).Error("error preparing reactions insert")
 		return nil
 	}
 
 	del, err := db.Prepare("DELETE from reactions WHERE target=? AND emoji=?")
 	if err != nil {
-		fmt.Printf("error preparing reactions delete: %v\n", err)
+		logger.WithError(err).Error("error preparing reactions delete")
 		return nil
 	}
 
 	sel, err := db.Prepare("SELECT emoji, target FROM reactions")
 	if err != nil {
-		fmt.Printf("error preparing reactions select: %v\n", err)
+		logger.WithError(err).Error("error preparing reactions select")
 		return nil
 	}
 
-	return &ReactCommand{rtm, exp, ins, del, sel}
+	return &ReactCommand{chat, cfg.Prefix, exp, ins, del, sel}
 }
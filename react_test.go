@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReactCommand(t *testing.T) {
+	bot := newTestBot(t, nil)
+
+	bot.expect(testAliceID, "?react :cat: to meow", "Got it.")
+
+	msg := &Message{User: testBobID, Channel: testChannelID, Text: "the cat said MEOW", Timestamp: "100.1"}
+	bot.router.Dispatch(context.Background(), bot.chat, msg)
+
+	sent, reactions, _ := bot.chat.Flush()
+	if len(sent) != 0 {
+		t.Errorf("expected no replies, got %d", len(sent))
+	}
+
+	want := MemoryReaction{"cat", testChannelID, "100.1"}
+	if len(reactions) != 1 || reactions[0] != want {
+		t.Errorf("got reactions %+v, want %+v", reactions, want)
+	}
+
+	bot.expect(testAliceID, "?unreact :cat: to meow", "Removed :cat: reaction")
+
+	bot.router.Dispatch(context.Background(), bot.chat, msg)
+	_, reactions, _ = bot.chat.Flush()
+	if len(reactions) != 0 {
+		t.Errorf("expected no reactions after unreact, got %+v", reactions)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Timeout for commands that haven't been given one with SetTimeout
+const defaultCommandTimeout = 10 * time.Second
+
+type route struct {
+	name     string
+	triggers []string
+	cmd      SlackCatCommand
+}
+
+type listenerRoute struct {
+	name     string
+	listener SlackCatListener
+}
+
+type reactionRoute struct {
+	name     string
+	listener SlackCatReactionListener
+}
+
+// Router decides which command handles a message. A message is handled
+// by at most one command, resolved in this order:
+//
+//  1. Explicit commands, looked up by the first word after the prefix
+//     (the trigger). Each trigger belongs to exactly one command.
+//  2. Fallthrough commands, tried in registration order, when no
+//     explicit command handled the message (learn recall for example).
+//
+// Listeners passively see every message that no command handled and
+// reaction listeners see every reaction.
+//
+// Every command and listener runs with a timeout and a panic in one
+// is logged as an error instead of taking the whole bot down.
+type Router struct {
+	prefix       string
+	triggers     map[string]*route
+	commands     []*route
+	fallthroughs []*route
+	listeners    []*listenerRoute
+	reactions    []*reactionRoute
+	timeouts     map[string]time.Duration
+	errs         []string
+}
+
+// AddCommand registers an explicit command under the given triggers,
+// which are matched case insensitively against the word right after
+// the prefix (for "?++d 5 Nickel" the trigger is "++d").
+func (r *Router) AddCommand(name string, cmd SlackCatCommand, triggers ...string) {
+	for _, rt := range r.commands {
+		if rt.name == name {
+			r.errs = append(r.errs, fmt.Sprintf("command %s is registered more than once", name))
+			return
+		}
+	}
+
+	rt := &route{name, triggers, cmd}
+	for _, trigger := range triggers {
+		trigger = strings.ToLower(trigger)
+		if other, ok := r.triggers[trigger]; ok {
+			r.errs = append(r.errs, fmt.Sprintf("trigger %s%s is claimed by both %s and %s", r.prefix, trigger, other.name, name))
+			continue
+		}
+
+		r.triggers[trigger] = rt
+	}
+
+	r.commands = append(r.commands, rt)
+}
+
+// AddFallthrough registers a command that is only tried when no
+// explicit command handled a message.
+func (r *Router) AddFallthrough(name string, cmd SlackCatCommand) {
+	for _, rt := range r.fallthroughs {
+		if rt.name == name {
+			r.errs = append(r.errs, fmt.Sprintf("fallthrough %s is registered more than once", name))
+			return
+		}
+	}
+
+	r.fallthroughs = append(r.fallthroughs, &route{name, nil, cmd})
+}
+
+func (r *Router) AddListener(name string, listener SlackCatListener) {
+	for _, lr := range r.listeners {
+		if lr.name == name {
+			r.errs = append(r.errs, fmt.Sprintf("listener %s is registered more than once", name))
+			return
+		}
+	}
+
+	r.listeners = append(r.listeners, &listenerRoute{name, listener})
+}
+
+func (r *Router) AddReactionListener(name string, listener SlackCatReactionListener) {
+	for _, rr := range r.reactions {
+		if rr.name == name {
+			r.errs = append(r.errs, fmt.Sprintf("reaction listener %s is registered more than once", name))
+			return
+		}
+	}
+
+	r.reactions = append(r.reactions, &reactionRoute{name, listener})
+}
+
+// SetTimeout limits how long the command, fallthrough or listener
+// registered under name gets to handle a message.
+func (r *Router) SetTimeout(name string, timeout time.Duration) {
+	r.timeouts[name] = timeout
+}
+
+// Validate reports any ambiguous or duplicate registrations.
+func (r *Router) Validate() error {
+	if len(r.errs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("ambiguous command registrations:\n  %s", strings.Join(r.errs, "\n  "))
+}
+
+// Commands lists the explicit commands in the order they were registered
+func (r *Router) Commands() []SlackCatCommand {
+	cmds := make([]SlackCatCommand, 0, len(r.commands))
+	for _, rt := range r.commands {
+		cmds = append(cmds, rt.cmd)
+	}
+
+	return cmds
+}
+
+// Resolve finds the command that should handle msg, if any.
+func (r *Router) Resolve(msg *Message) SlackCatCommand {
+	rt := r.resolve(msg)
+	if rt == nil {
+		return nil
+	}
+
+	return rt.cmd
+}
+
+func (r *Router) resolve(msg *Message) *route {
+	if strings.HasPrefix(msg.Text, r.prefix) {
+		word := strings.SplitN(msg.Text[len(r.prefix):], " ", 2)[0]
+		rt, ok := r.triggers[strings.ToLower(word)]
+		if ok && rt.cmd.Matches(msg) {
+			return rt
+		}
+	}
+
+	for _, rt := range r.fallthroughs {
+		if rt.cmd.Matches(msg) {
+			return rt
+		}
+	}
+
+	return nil
+}
+
+// Dispatch runs msg through whichever command handles it and sends the
+// reply. Listeners only get the message if no command handled it.
+func (r *Router) Dispatch(ctx context.Context, chat ChatClient, msg *Message) {
+	defer func() {
+		//Matching happens outside of run so guard it here too
+		if p := recover(); p != nil {
+			logger.WithFields(messageFields(msg)).WithField("stack", string(debug.Stack())).Errorf("panic routing message: %v", p)
+		}
+	}()
+
+	rt := r.resolve(msg)
+	if rt != nil {
+		start := time.Now()
+		out, err := r.run(ctx, rt.name, func(ctx context.Context) (*OutgoingMessage, error) {
+			return rt.cmd.Execute(ctx, msg)
+		})
+
+		latency := time.Since(start)
+		commandInvocations.WithLabelValues(rt.name).Inc()
+		commandDuration.WithLabelValues(rt.name).Observe(latency.Seconds())
+
+		entry := logger.WithFields(messageFields(msg)).WithFields(logrus.Fields{
+			"command":    rt.name,
+			"latency_ms": latency.Seconds() * 1000,
+		})
+
+		if err != nil {
+			commandErrors.WithLabelValues(rt.name).Inc()
+			entry.WithError(err).Error("command failed")
+		} else {
+			entry.Info("command handled")
+		}
+
+		if out != nil {
+			chat.SendMessage(out)
+		}
+		return
+	}
+
+	for _, lr := range r.listeners {
+		listener := lr.listener
+		_, err := r.run(ctx, lr.name, func(ctx context.Context) (*OutgoingMessage, error) {
+			return nil, listener.Listen(ctx, msg)
+		})
+
+		if err != nil {
+			logger.WithFields(messageFields(msg)).WithField("listener", lr.name).WithError(err).Error("listener failed")
+		}
+	}
+}
+
+// DispatchReaction hands a reaction to every reaction listener
+func (r *Router) DispatchReaction(ctx context.Context, chat ChatClient, reaction *Reaction) {
+	for _, rr := range r.reactions {
+		listener := rr.listener
+		_, err := r.run(ctx, rr.name, func(ctx context.Context) (*OutgoingMessage, error) {
+			return nil, listener.React(ctx, reaction)
+		})
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"user":     reaction.User,
+				"channel":  reaction.Channel,
+				"reaction": reaction.Emoji,
+				"listener": rr.name,
+			}).WithError(err).Error("reaction listener failed")
+		}
+	}
+}
+
+type runResult struct {
+	out *OutgoingMessage
+	err error
+}
+
+// Runs f with the timeout for name, turning panics into errors. If f
+// doesn't return before the timeout it is left to finish on its own
+// and whatever it produces is dropped.
+func (r *Router) run(ctx context.Context, name string, f func(ctx context.Context) (*OutgoingMessage, error)) (*OutgoingMessage, error) {
+	timeout, ok := r.timeouts[name]
+	if !ok {
+		timeout = defaultCommandTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan runResult, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- runResult{nil, fmt.Errorf("panic: %v\n%s", p, debug.Stack())}
+			}
+		}()
+
+		out, err := f(ctx)
+		done <- runResult{out, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.out, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("gave up after %v: %v", timeout, ctx.Err())
+	}
+}
+
+// Close closes every registered command and listener once
+func (r *Router) Close() {
+	closed := make(map[interface{}]bool)
+	closeOnce := func(c interface{ Close() }) {
+		if !closed[c] {
+			closed[c] = true
+			c.Close()
+		}
+	}
+
+	for _, rt := range r.commands {
+		closeOnce(rt.cmd)
+	}
+
+	for _, rt := range r.fallthroughs {
+		closeOnce(rt.cmd)
+	}
+
+	for _, lr := range r.listeners {
+		closeOnce(lr.listener)
+	}
+
+	for _, rr := range r.reactions {
+		closeOnce(rr.listener)
+	}
+}
+
+func NewRouter(prefix string) *Router {
+	return &Router{
+		prefix:   prefix,
+		triggers: make(map[string]*route),
+		timeouts: make(map[string]time.Duration),
+	}
+}
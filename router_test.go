@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slowCommand posts to chat itself and then again once it's released,
+// like ?update does while it works
+type slowCommand struct {
+	chat     ChatClient
+	release  chan struct{}
+	finished chan error
+}
+
+func (c *slowCommand) Matches(msg *Message) bool {
+	return msg.Text == "?slow"
+}
+
+func (c *slowCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	sendMessage(ctx, c.chat, NewOutgoingMessage("started", msg.Channel))
+	<-c.release
+	c.finished <- sendMessage(ctx, c.chat, NewOutgoingMessage("finished", msg.Channel))
+
+	return NewOutgoingMessage("done", msg.Channel), nil
+}
+
+func (c *slowCommand) GetSyntax() string {
+	return "?slow"
+}
+
+func (c *slowCommand) GetDescription() string {
+	return "Takes its time"
+}
+
+func (c *slowCommand) Close() {
+}
+
+func TestRouterDropsLateSends(t *testing.T) {
+	chat := NewMemoryTransport()
+	cmd := &slowCommand{chat, make(chan struct{}), make(chan error, 1)}
+
+	router := NewRouter("?")
+	router.AddCommand("slow", cmd, "slow")
+	router.SetTimeout("slow", 10*time.Millisecond)
+
+	msg := &Message{User: testAliceID, Channel: testChannelID, Text: "?slow", Timestamp: "1.1"}
+	router.Dispatch(context.Background(), chat, msg)
+
+	//The router has given up by now so the command's next send is dropped
+	close(cmd.release)
+	err := <-cmd.finished
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the late send to fail with %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	sent, _, _ := chat.Flush()
+	if len(sent) != 1 || sent[0].Text != "started" {
+		t.Errorf("expected only the message sent before the timeout, got %+v", sent)
+	}
+}
+
+func TestExecutorChannelsDontWait(t *testing.T) {
+	chat := NewMemoryTransport()
+	cmd := &slowCommand{chat, make(chan struct{}), make(chan error, 2)}
+
+	router := NewRouter("?")
+	router.AddCommand("slow", cmd, "slow")
+
+	executor := NewExecutor(router, chat, 2)
+
+	//The second channel starts while the first is still busy
+	executor.Submit(&Message{User: testAliceID, Channel: "CFIRST", Text: "?slow", Timestamp: "1.1"})
+	executor.Submit(&Message{User: testAliceID, Channel: "CSECOND", Text: "?slow", Timestamp: "1.2"})
+
+	started := 0
+	deadline := time.Now().Add(fakeSlackTimeout)
+	for started < 2 && time.Now().Before(deadline) {
+		sent, _, _ := chat.Flush()
+		started += len(sent)
+		time.Sleep(time.Millisecond)
+	}
+
+	if started != 2 {
+		t.Errorf("expected both channels to start, %d did", started)
+	}
+
+	close(cmd.release)
+	executor.Close()
+}
@@ -1,122 +1,277 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/nlopes/slack"
 	"log"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 )
 
 func main() {
 
-	if len(os.Args) != 3 {
-		fmt.Fprintf(os.Stderr, "usage: slackcat <slack-bot-token> <slack-user-id>\n")
+	cfgPath := flag.String("config", "", "path to the slackcat config file (defaults to slackcat.toml next to the executable)")
+	flag.Parse()
+
+	mode := flag.Arg(0)
+	switch {
+	case flag.NArg() == 0:
+	case mode == "migrate" && flag.NArg() == 2 && (flag.Arg(1) == "status" || flag.Arg(1) == "up"):
+	case mode == "console":
+	default:
+		fmt.Fprintf(os.Stderr, "usage: slackcat [-config <path>] [migrate status|up] [console [-user <name>] [-channel <name>] [-db <path>]]\n")
 		os.Exit(1)
 	}
 
-	logger := log.New(os.Stdout, "slack-cat: ", log.Lshortfile|log.LstdFlags)
-	slack.SetLogger(logger)
+	//An explicitly passed config file has to exist
+	required := *cfgPath != ""
+	if !required {
+		*cfgPath = defaultConfigPath()
+	}
+
+	cfg, err := LoadConfig(*cfgPath, required)
+	if err == nil {
+		//Only the bot itself needs to talk to slack
+		err = cfg.Validate(mode == "")
+	}
 
-	exe, err := os.Executable()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not determine executable location")
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 
-	loc := filepath.Dir(exe)
-	db, err := sql.Open("sqlite3", filepath.Join(loc, "slackcat.db"))
+	var console *ConsoleOptions
+	if mode == "console" {
+		console, err = ParseConsoleOptions(flag.Args()[1:])
+		if err == flag.ErrHelp {
+			PrintConsoleUsage(os.Stdout)
+			return
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid console options: %v\n", err)
+			PrintConsoleUsage(os.Stderr)
+			os.Exit(1)
+		}
+
+		cfg.Database = console.Database
+	}
+
+	slack.SetLogger(log.New(logger.WithField("source", "slack").Writer(), "", 0))
+
+	//Transactions take the write lock up front so concurrent writers wait
+	//their turn rather than failing part way through with "database is locked"
+	db, err := sql.Open(instrumentedSqlite, cfg.Database+"?_txlock=immediate")
 	defer db.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Could not open database connection")
 		os.Exit(1)
 	}
 
-	client := slack.New(os.Args[1])
-	_, _, adminChan, err := client.OpenIMChannel(os.Args[2])
+	migrator := NewMigrator(db, schemaMigrations)
+	if mode == "migrate" && flag.Arg(1) == "status" {
+		err = NewMigrator(db, append(schemaMigrations, chatMigrations(nil)...)).Status(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read migration status: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err = migrator.Up()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not establish admin PM channel")
+		fmt.Fprintf(os.Stderr, "Could not migrate database: %v\n", err)
 		os.Exit(1)
 	}
 
-	//TODO: Add new webhooks to this slice
-	callbacks := []SlackCatCallback{
-		NewSonarrCallback(client, adminChan), //Sonarr Responses will just go to the admin
+	switch mode {
+	case "migrate":
+		return
+	case "console":
+		RunConsole(cfg, db, console, os.Stdin, os.Stdout)
+		return
+	}
+
+	client := slack.New(cfg.Token)
+	callbacks, err := buildCallbacks(client, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not establish admin PM channel")
+		os.Exit(1)
 	}
 
-	defer func(callbacks []SlackCatCallback) {
+	defer func(callbacks map[string]SlackCatCallback) {
 		for _, callback := range callbacks {
 			callback.Close()
 		}
 	}(callbacks)
 
+	hooks := NewWebhookServer(cfg.Listen, callbacks)
+	err = hooks.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not start webhook server: %v\n", err)
+		os.Exit(1)
+	}
+	defer hooks.Close()
+
 	rtm := client.NewRTM()
 	defer rtm.Disconnect()
 	go rtm.ManageConnection()
 
-	//TODO: Add commands to this slice
-	cmds := []SlackCatCommand{
-		NewPlusCommand(rtm, db),
-		NewPlusDenominationCommand(rtm, db),
-		NewGifCommand(rtm),
-		NewGiphyCommand(rtm),
-		NewHaltCommand(rtm),
-		NewUpdateCommand(rtm),
-		//Learn command should match everything so keep it last
-		NewLearnCommand(rtm, db),
-		NewReactCommand(rtm, db),
+	chat := NewSlackTransport(rtm)
+	err = NewMigrator(db, chatMigrations(chat)).Up()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not migrate database: %v\n", err)
+		os.Exit(1)
 	}
 
-	//Help is a meta command so it needs to be handled a
-	//little differently than normal slack cat commands
-	cmds = append([]SlackCatCommand{NewHelpCommand(rtm, cmds)}, cmds...)
+	router, err := buildRouter(chat, db, cfg)
+	defer router.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 
-	defer func(cmds []SlackCatCommand) {
-		for _, cmd := range cmds {
-			cmd.Close()
-		}
-	}(cmds)
+	executor := NewExecutor(router, chat, cfg.Workers)
+	defer executor.Close()
 
-	disconnect := false
+	runEventLoop(rtm, executor)
+}
 
-	for msg := range rtm.IncomingEvents {
-		if disconnect {
-			break
-		}
+// Handles RTM events until slack cat is intentionally disconnected
+func runEventLoop(rtm *slack.RTM, executor *Executor) {
+	//Filled in once connected so slack cat can recognise its own messages
+	self := ""
 
+	for msg := range rtm.IncomingEvents {
 		switch ev := msg.Data.(type) {
 		case *slack.MessageEvent:
-			for _, cmd := range cmds {
-				match, cont := cmd.Matches(&ev.Msg)
-				if match {
-					out, err := cmd.Execute(&ev.Msg)
-					if err != nil {
-						fmt.Printf("Command Error: %v\n", err)
-					}
-
-					if out != nil {
-						rtm.SendMessage(out)
-					}
-
-					if !cont {
-						break
-					}
-				}
+			executor.Submit(NewSlackMessage(&ev.Msg, self))
+
+		case *slack.ReactionAddedEvent:
+			executor.SubmitReaction(NewSlackReaction(ev, false))
+
+		case *slack.ReactionRemovedEvent:
+			executor.SubmitReaction(NewSlackReaction((*slack.ReactionAddedEvent)(ev), true))
+
+		case *slack.ConnectedEvent:
+			if ev.Info != nil && ev.Info.User != nil {
+				self = ev.Info.User.ID
+			}
+
+			if ev.ConnectionCount > 1 {
+				rtmReconnects.Inc()
 			}
 
 		case *slack.DisconnectedEvent:
-			disconnect = ev.Intentional
-			break
+			//Nothing else arrives after an intentional disconnect so
+			//waiting for another event would block forever
+			if ev.Intentional {
+				return
+			}
+
+		}
+	}
+}
 
+// Builds every callback that is enabled in the config, keyed by the name
+// used in the webhook url (POST /hooks/<name>). Callbacks post to the
+// admin unless they are given a channel.
+func buildCallbacks(client *slack.Client, cfg *Config) (map[string]SlackCatCallback, error) {
+	_, _, adminChan, err := client.OpenIMChannel(cfg.Admin)
+	if err != nil {
+		return nil, err
+	}
+
+	//TODO: Add new webhooks to this map
+	callbacks := map[string]SlackCatCallback{}
+	if cfg.Callbacks.Sonarr.Enabled {
+		respChan := cfg.Callbacks.Sonarr.Channel
+		if respChan == "" {
+			respChan = adminChan //Sonarr Responses default to the admin
 		}
+		callbacks["sonarr"] = NewSonarrCallback(client, respChan)
 	}
+
+	return callbacks, nil
 }
 
-func parseUsernamesAndChannels(client *slack.Client, txt string) string {
+// Registers every command that is enabled in the config with a router
+func buildRouter(chat ChatClient, db *sql.DB, cfg *Config) (*Router, error) {
+	//TODO: Add commands to the router
+	router := NewRouter(cfg.Prefix)
+	//Shared so the plus command sees denomination changes straight away
+	denoms := NewPlusDenominations(db)
+	if cfg.Commands.Plus.Enabled {
+		plus := NewPlusCommand(chat, db, denoms, cfg.Commands.Plus, cfg.Commands.PlusWallet.Enabled)
+		router.AddCommand("plus", plus, "++", "--")
+		router.AddListener("plus", plus)
+		router.AddReactionListener("plus", plus)
+		//These read what the plus command stores so they only make sense with it
+		if cfg.Commands.PlusLeaderboard.Enabled {
+			router.AddCommand("plus_leaderboard", NewPlusLeaderboardCommand(chat, db, plus, cfg.Commands.PlusLeaderboard), "++top", "--bottom", "rank")
+		}
+		if cfg.Commands.PlusWhy.Enabled {
+			router.AddCommand("plus_why", NewPlusWhyCommand(chat, db, plus, cfg.Commands.PlusWhy), "why")
+		}
+		if cfg.Commands.PlusAlias.Enabled {
+			router.AddCommand("plus_alias", NewPlusAliasCommand(chat, db, plus, cfg.Commands.PlusAlias), "++alias", "++merge", "++aliases")
+		}
+		if cfg.Commands.PlusSeason.Enabled {
+			router.AddCommand("plus_season", NewPlusSeasonCommand(chat, db, plus, cfg.Commands.PlusSeason), "++season", "++endseason", "++alltime")
+		}
+		if cfg.Commands.PlusGraph.Enabled {
+			router.AddCommand("plus_graph", NewPlusGraphCommand(chat, db, plus, cfg.Commands.PlusGraph), "++graph")
+		}
+		if cfg.Commands.PlusWallet.Enabled {
+			router.AddCommand("plus_wallet", NewPlusWalletCommand(chat, db, plus, cfg.Commands.PlusWallet), "give", "balance", "mint")
+		}
+		if cfg.Commands.PlusShop.Enabled {
+			router.AddCommand("plus_shop", NewPlusShopCommand(chat, db, plus, cfg.Commands.PlusShop), "shop", "buy")
+		}
+	}
+	if cfg.Commands.PlusDenomination.Enabled {
+		router.AddCommand("plus_denomination", NewPlusDenominationCommand(chat, db, denoms, cfg.Commands.PlusDenomination), "++d", "--d")
+	}
+	if cfg.Commands.Gif.Enabled {
+		router.AddCommand("gif", NewGifCommand(chat, cfg.Commands.Gif), "gif")
+	}
+	if cfg.Commands.Giphy.Enabled {
+		router.AddCommand("giphy", NewGiphyCommand(chat, cfg.Commands.Giphy), "giphy")
+	}
+	if cfg.Commands.Halt.Enabled {
+		router.AddCommand("halt", NewHaltCommand(chat, cfg.Commands.Halt), "halt")
+	}
+	if cfg.Commands.Update.Enabled {
+		router.AddCommand("update", NewUpdateCommand(chat, cfg.Commands.Update), "update")
+	}
+	if cfg.Commands.Learn.Enabled {
+		learn := NewLearnCommand(chat, db, cfg.Commands.Learn)
+		router.AddCommand("learn", learn, "learn", "unlearn")
+		//Recalling learned things matches any ?<target>
+		router.AddFallthrough("learn", learn)
+	}
+	if cfg.Commands.React.Enabled {
+		react := NewReactCommand(chat, db, cfg.Commands.React)
+		router.AddCommand("react", react, "react", "unreact")
+		router.AddListener("react", react)
+	}
+
+	//Help is a meta command so it needs to be handled a
+	//little differently than normal slack cat commands
+	if cfg.Commands.Help.Enabled {
+		router.AddCommand("help", NewHelpCommand(chat, router.Commands(), cfg.Commands.Help), "help")
+	}
+
+	for name, cmdCfg := range cfg.commandConfigs() {
+		router.SetTimeout(name, cmdCfg.Timeout.Duration)
+	}
+
+	return router, router.Validate()
+}
+
+func parseUsernamesAndChannels(client ChatClient, txt string) string {
 	userReg := regexp.MustCompile("^.*?(<@(\\w+)>).*?$")
 	chanReg := regexp.MustCompile("^.*?(<#(\\w+)\\|?(\\w*)>).*?$")
 	if userReg.MatchString(txt) {
@@ -145,13 +300,26 @@ func parseUsernamesAndChannels(client *slack.Client, txt string) string {
 }
 
 type SlackCatCommand interface {
-	Matches(msg *slack.Msg) (bool, bool)
-	Execute(msg *slack.Msg) (*slack.OutgoingMessage, error)
+	Matches(msg *Message) bool
+	Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error)
 	GetSyntax() string
 	GetDescription() string
 	Close()
 }
 
+// SlackCatListener passively watches messages that no command handled
+type SlackCatListener interface {
+	Listen(ctx context.Context, msg *Message) error
+	Close()
+}
+
+// SlackCatReactionListener is told about every reaction added to or
+// removed from a message
+type SlackCatReactionListener interface {
+	React(ctx context.Context, r *Reaction) error
+	Close()
+}
+
 type SlackCatCallback interface {
 	Handle(blob []byte) error
 	Close()
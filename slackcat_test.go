@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jimdoescode/slackcat/fakeslack"
+	"github.com/nlopes/slack"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Ids of the users and channel every test bot knows about
+const (
+	testAdminID   = "UADMIN"
+	testAliceID   = "UALICE"
+	testBobID     = "UBOB"
+	testChannelID = "CGENERAL"
+)
+
+var testTimestamp int64
+
+// testBot runs commands the same way the bot does, against an in memory
+// chat and a scratch database.
+type testBot struct {
+	t      *testing.T
+	chat   *MemoryTransport
+	db     *sql.DB
+	router *Router
+}
+
+// Sends txt as user and returns the text of every message sent in reply
+func (b *testBot) say(user string, txt string) []string {
+	b.t.Helper()
+
+	msg := &Message{
+		User:      user,
+		Channel:   testChannelID,
+		Text:      txt,
+		Timestamp: strconv.FormatInt(atomic.AddInt64(&testTimestamp, 1), 10),
+	}
+
+	b.router.Dispatch(context.Background(), b.chat, msg)
+	sent, _, _ := b.chat.Flush()
+
+	var replies []string
+	for _, out := range sent {
+		replies = append(replies, out.Text)
+	}
+
+	return replies
+}
+
+// Same as say but expects exactly one reply
+func (b *testBot) expect(user string, txt string, want string) {
+	b.t.Helper()
+
+	replies := b.say(user, txt)
+	if len(replies) != 1 || replies[0] != want {
+		b.t.Errorf("%s:\n got %q\nwant %q", txt, replies, []string{want})
+	}
+}
+
+// Opens a migrated database in a temp dir the same way the bot does
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := openTestDB(t)
+	err := NewMigrator(db, schemaMigrations).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// Opens an empty database in a temp dir, for tests of the migrations themselves
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "slackcat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(instrumentedSqlite, filepath.Join(dir, "slackcat.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// Builds a bot with the default config, which configure can change
+// before the commands are registered.
+func newTestBot(t *testing.T, configure func(cfg *Config)) *testBot {
+	t.Helper()
+
+	cfg, err := defaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Admin = testAdminID
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.applyShared()
+
+	chat := NewMemoryTransport()
+	chat.AddUser(testAdminID, "admin")
+	chat.AddUser(testAliceID, "alice")
+	chat.AddUser(testBobID, "bob")
+	chat.AddChannel(testChannelID, "general")
+
+	db := newTestDB(t)
+	router, err := buildRouter(chat, db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		router.Close()
+		db.Close()
+	})
+
+	return &testBot{t, chat, db, router}
+}
+
+// How long to wait on the fake slack server before giving up
+const fakeSlackTimeout = 5 * time.Second
+
+func TestEventLoop(t *testing.T) {
+	server := fakeslack.NewServer()
+	defer server.Close()
+	server.AddUser(testAdminID, "admin")
+	server.AddUser(testAliceID, "alice")
+	server.AddUser(testBobID, "bob")
+	server.AddChannel(testChannelID, "general")
+
+	api := slack.SLACK_API
+	slack.SLACK_API = server.APIURL()
+	defer func() { slack.SLACK_API = api }()
+
+	rtm := slack.New("xoxb-test").NewRTM()
+	go rtm.ManageConnection()
+
+	chat := NewSlackTransport(rtm)
+	db := newTestDB(t)
+	defer db.Close()
+
+	err := NewMigrator(db, chatMigrations(chat)).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := defaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Admin = testAdminID
+	noPlusCooldown(cfg)
+	cfg.applyShared()
+
+	router, err := buildRouter(chat, db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	executor := NewExecutor(router, chat, 2)
+	defer executor.Close()
+
+	done := make(chan struct{})
+	go func() {
+		runEventLoop(rtm, executor)
+		close(done)
+	}()
+
+	err = server.WaitForConnection(fakeSlackTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Each reply is waited for before sending the next event so the
+	//frames arrive in a known order
+	replies := 0
+	expectFrame := func(want string, thread string) {
+		t.Helper()
+
+		replies++
+		frames, err := server.WaitForFrames(replies, fakeSlackTimeout)
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", want, err)
+		}
+
+		got := frames[replies-1]
+		if got.Type != "message" || got.Channel != testChannelID || got.Text != want || got.ThreadTimestamp != thread {
+			t.Errorf("got frame %+v, want %q in %s (thread %q)", got, want, testChannelID, thread)
+		}
+	}
+
+	_, err = server.SendMessage(testAliceID, testChannelID, "?++ <@UBOB>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFrame("alice gave a plus to <@UBOB>, <@UBOB> now has 1 plus.", "")
+
+	ts, err := server.SendMessage(testBobID, testChannelID, "I fixed the build")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.SendReaction(testAliceID, testBobID, testChannelID, ts, "heavy_plus_sign", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFrame("alice gave a plus to bob, bob now has 2 pluses.", ts)
+
+	err = server.SendReaction(testAliceID, testBobID, testChannelID, ts, "heavy_plus_sign", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFrame("alice took a plus from bob, bob now has 1 plus.", ts)
+
+	_, err = server.SendMessage(testAliceID, testChannelID, "?react :cat: to meow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFrame("Got it.", "")
+
+	ts, err = server.SendMessage(testBobID, testChannelID, "meow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reactions, err := server.WaitForReactions(1, fakeSlackTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fakeslack.Reaction{Name: "cat", Channel: testChannelID, Timestamp: ts}
+	if reactions[0] != want {
+		t.Errorf("got reaction %+v, want %+v", reactions[0], want)
+	}
+
+	rtm.Disconnect()
+	select {
+	case <-done:
+	case <-time.After(fakeSlackTimeout):
+		t.Fatal("event loop still running after an intentional disconnect")
+	}
+}
+
+func TestCallbacksPostToAdmin(t *testing.T) {
+	server := fakeslack.NewServer()
+	defer server.Close()
+	server.AddUser(testAdminID, "admin")
+
+	api := slack.SLACK_API
+	slack.SLACK_API = server.APIURL()
+	defer func() { slack.SLACK_API = api }()
+
+	cfg, err := defaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Admin = testAdminID
+
+	callbacks, err := buildCallbacks(slack.New("xoxb-test"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ims := server.OpenedIMs()
+	if len(ims) != 1 || ims[0] != testAdminID {
+		t.Errorf("expected an IM to be opened with the admin, got %q", ims)
+	}
+
+	blob, err := os.Open(filepath.Join("testdata", "sonarr", "grab.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+
+	rec := httptest.NewRecorder()
+	NewWebhookServer("", callbacks).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/hooks/sonarr", blob))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	want := fakeslack.PostedMessage{
+		Channel: fakeslack.IMChannel(testAdminID),
+		Text:    `Grabbed *The Office* S03E01 "Gay Witch Hunt", S03E02 "The Convention" [HDTV-720p] (LOL)`,
+	}
+
+	posted := server.PostedMessages()
+	if len(posted) != 1 || posted[0] != want {
+		t.Errorf("got posted messages %+v, want %+v", posted, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"io"
+)
+
+// SlackTransport adapts a slack RTM connection to the ChatClient interface.
+type SlackTransport struct {
+	rtm *slack.RTM
+}
+
+func (t *SlackTransport) SendMessage(msg *OutgoingMessage) error {
+	out := t.rtm.NewOutgoingMessage(msg.Text, msg.Channel)
+	out.ThreadTimestamp = msg.ThreadTimestamp
+	t.rtm.SendMessage(out)
+	return nil
+}
+
+func (t *SlackTransport) AddReaction(emoji string, channel string, timestamp string) error {
+	return t.rtm.AddReaction(emoji, slack.NewRefToMessage(channel, timestamp))
+}
+
+func (t *SlackTransport) UploadFile(channel string, filename string, title string, r io.Reader) error {
+	_, err := t.rtm.UploadFile(slack.FileUploadParameters{
+		Reader:   r,
+		Filename: filename,
+		Title:    title,
+		Channels: []string{channel},
+	})
+	return err
+}
+
+func (t *SlackTransport) GetUserInfo(id string) (*ChatUser, error) {
+	user, err := t.rtm.GetUserInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatUser{user.ID, user.Name}, nil
+}
+
+func (t *SlackTransport) ListUsers() ([]ChatUser, error) {
+	users, err := t.rtm.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]ChatUser, 0, len(users))
+	for _, user := range users {
+		list = append(list, ChatUser{user.ID, user.Name})
+	}
+
+	return list, nil
+}
+
+func (t *SlackTransport) GetChannelInfo(id string) (*ChatChannel, error) {
+	ch, err := t.rtm.GetChannelInfo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatChannel{ch.ID, ch.Name}, nil
+}
+
+func (t *SlackTransport) Disconnect() error {
+	return t.rtm.Disconnect()
+}
+
+// NewSlackMessage converts a slack message event into a Message. self
+// is slack cat's own user id, which slack echoes its messages back as.
+func NewSlackMessage(msg *slack.Msg, self string) *Message {
+	return &Message{
+		User:      msg.User,
+		Channel:   msg.Channel,
+		Text:      msg.Text,
+		Timestamp: msg.Timestamp,
+		Bot:       msg.User == self || msg.SubType == "bot_message" || msg.BotID != "",
+	}
+}
+
+// NewSlackReaction converts a reaction event into a Reaction. Added and
+// removed events share the same fields so removals can be converted
+// to a *slack.ReactionAddedEvent to be passed in here.
+func NewSlackReaction(ev *slack.ReactionAddedEvent, removed bool) *Reaction {
+	return &Reaction{
+		User:      ev.User,
+		ItemUser:  ev.ItemUser,
+		Channel:   ev.Item.Channel,
+		Timestamp: ev.Item.Timestamp,
+		Emoji:     ev.Reaction,
+		Removed:   removed,
+	}
+}
+
+func NewSlackTransport(rtm *slack.RTM) *SlackTransport {
+	return &SlackTransport{rtm}
+}
@@ -1,23 +1,205 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/nlopes/slack"
+	"net/http"
+	"strings"
 )
 
+type sonarrSeries struct {
+	Id     int    `json:"id"`
+	Title  string `json:"title"`
+	Path   string `json:"path"`
+	TvdbId int    `json:"tvdbId"`
+}
+
+type sonarrEpisode struct {
+	Id            int    `json:"id"`
+	EpisodeNumber int    `json:"episodeNumber"`
+	SeasonNumber  int    `json:"seasonNumber"`
+	Title         string `json:"title"`
+	Quality       string `json:"quality"`
+	ReleaseGroup  string `json:"releaseGroup"`
+}
+
+type sonarrRelease struct {
+	Quality      string `json:"quality"`
+	ReleaseGroup string `json:"releaseGroup"`
+	ReleaseTitle string `json:"releaseTitle"`
+	Indexer      string `json:"indexer"`
+	Size         int64  `json:"size"`
+}
+
+type sonarrEpisodeFile struct {
+	RelativePath string `json:"relativePath"`
+	Quality      string `json:"quality"`
+	ReleaseGroup string `json:"releaseGroup"`
+	SceneName    string `json:"sceneName"`
+}
+
+type sonarrPayload struct {
+	EventType    string             `json:"eventType"`
+	Series       *sonarrSeries      `json:"series"`
+	Episodes     []sonarrEpisode    `json:"episodes"`
+	Release      *sonarrRelease     `json:"release"`
+	EpisodeFile  *sonarrEpisodeFile `json:"episodeFile"`
+	IsUpgrade    bool               `json:"isUpgrade"`
+	DeleteReason string             `json:"deleteReason"`
+
+	//Health events
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	WikiUrl string `json:"wikiUrl"`
+}
+
 type SonarrCallback struct {
 	client   *slack.Client
 	respChan string
 }
 
 func (c *SonarrCallback) Handle(blob []byte) error {
-	_, _, err := c.client.PostMessage(c.respChan, "ping", slack.NewPostMessageParameters())
-	return err
+	payload, err := parseSonarrPayload(blob)
+	if err != nil {
+		return NewCallbackError(http.StatusBadRequest, err)
+	}
+
+	txt := c.getMessage(payload)
+	_, _, err = c.client.PostMessage(c.respChan, txt, slack.NewPostMessageParameters())
+	if err != nil {
+		return NewCallbackError(http.StatusBadGateway, err)
+	}
+
+	return nil
+}
+
+func (c *SonarrCallback) getMessage(p *sonarrPayload) string {
+	switch strings.ToLower(p.EventType) {
+	case "test":
+		return fmt.Sprintf("Sonarr test notification received for %s", c.getEpisodesDisplay(p, "", ""))
+
+	case "grab":
+		quality, group := "", ""
+		if p.Release != nil {
+			quality, group = p.Release.Quality, p.Release.ReleaseGroup
+		}
+		return fmt.Sprintf("Grabbed %s", c.getEpisodesDisplay(p, quality, group))
+
+	case "download":
+		quality, group := "", ""
+		if p.EpisodeFile != nil {
+			quality, group = p.EpisodeFile.Quality, p.EpisodeFile.ReleaseGroup
+		}
+
+		verb := "Downloaded"
+		if p.IsUpgrade {
+			verb = "Upgraded"
+		}
+		return fmt.Sprintf("%s %s", verb, c.getEpisodesDisplay(p, quality, group))
+
+	case "rename":
+		return fmt.Sprintf("Renamed episode files for %s", c.getSeriesTitle(p))
+
+	case "seriesdelete":
+		return fmt.Sprintf("Deleted series %s", c.getSeriesTitle(p))
+
+	case "episodefiledelete", "delete":
+		quality, group := "", ""
+		if p.EpisodeFile != nil {
+			quality, group = p.EpisodeFile.Quality, p.EpisodeFile.ReleaseGroup
+		}
+
+		txt := fmt.Sprintf("Deleted %s", c.getEpisodesDisplay(p, quality, group))
+		if p.DeleteReason != "" {
+			txt += fmt.Sprintf(" because of %s", p.DeleteReason)
+		}
+		return txt
+
+	case "health":
+		txt := fmt.Sprintf("Sonarr health %s: %s", strings.ToLower(p.Level), p.Message)
+		if p.WikiUrl != "" {
+			txt += fmt.Sprintf(" (%s)", p.WikiUrl)
+		}
+		return txt
+	}
+
+	logger.WithField("event_type", p.EventType).Warn("unknown sonarr event type")
+
+	if p.Series == nil {
+		return fmt.Sprintf("Sonarr sent a %s event", p.EventType)
+	}
+	return fmt.Sprintf("Sonarr sent a %s event for %s", p.EventType, c.getEpisodesDisplay(p, "", ""))
+}
+
+func (c *SonarrCallback) getSeriesTitle(p *sonarrPayload) string {
+	if p.Series == nil || p.Series.Title == "" {
+		return "an unknown series"
+	}
+
+	return fmt.Sprintf("*%s*", p.Series.Title)
+}
+
+// Renders something like "*Series Title* S01E01 "Episode" [HDTV-720p] (GROUP)"
+// for the payload's series and episodes. Quality and release group fall back
+// to the values on the first episode when they are not passed in.
+func (c *SonarrCallback) getEpisodesDisplay(p *sonarrPayload, quality string, group string) string {
+	buf := bytes.NewBufferString(c.getSeriesTitle(p))
+
+	for i, ep := range p.Episodes {
+		if i == 0 {
+			buf.WriteString(" ")
+		} else {
+			buf.WriteString(", ")
+		}
+
+		buf.WriteString(fmt.Sprintf("S%02dE%02d", ep.SeasonNumber, ep.EpisodeNumber))
+		if ep.Title != "" {
+			buf.WriteString(fmt.Sprintf(" \"%s\"", ep.Title))
+		}
+	}
+
+	if len(p.Episodes) > 0 {
+		if quality == "" {
+			quality = p.Episodes[0].Quality
+		}
+
+		if group == "" {
+			group = p.Episodes[0].ReleaseGroup
+		}
+	}
+
+	if quality != "" {
+		buf.WriteString(fmt.Sprintf(" [%s]", quality))
+	}
+
+	if group != "" {
+		buf.WriteString(fmt.Sprintf(" (%s)", group))
+	}
+
+	return buf.String()
 }
 
 func (c *SonarrCallback) Close() {
 
 }
 
+func parseSonarrPayload(blob []byte) (*sonarrPayload, error) {
+	var payload sonarrPayload
+	err := json.Unmarshal(blob, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.EventType == "" {
+		return nil, fmt.Errorf("Sonarr payload missing eventType")
+	}
+
+	return &payload, nil
+}
+
 func NewSonarrCallback(client *slack.Client, respChan string) *SonarrCallback {
 	return &SonarrCallback{client, respChan}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSonarrMessages(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{"test.json", `Sonarr test notification received for *Test Title* S01E01 "Test title"`},
+		{"grab.json", `Grabbed *The Office* S03E01 "Gay Witch Hunt", S03E02 "The Convention" [HDTV-720p] (LOL)`},
+		{"download.json", `Downloaded *The Office* S03E01 "Gay Witch Hunt" [WEBDL-1080p] (NTb)`},
+		{"upgrade.json", `Upgraded *The Office* S03E01 "Gay Witch Hunt" [Bluray-1080p] (DEMAND)`},
+		{"rename.json", `Renamed episode files for *The Office*`},
+		{"seriesdelete.json", `Deleted series *The Office*`},
+		{"episodefiledelete.json", `Deleted *The Office* S03E01 "Gay Witch Hunt" [HDTV-720p] (LOL) because of upgrade`},
+		{"health.json", `Sonarr health warning: Indexers unavailable due to failures: Newznab (https://wiki.servarr.com/sonarr/system#indexers-are-unavailable-due-to-failures)`},
+		{"unknown.json", `Sonarr sent a ApplicationUpdate event`},
+	}
+
+	c := NewSonarrCallback(nil, "")
+	for _, test := range tests {
+		blob, err := ioutil.ReadFile(filepath.Join("testdata", "sonarr", test.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload, err := parseSonarrPayload(blob)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.fixture, err)
+			continue
+		}
+
+		got := c.getMessage(payload)
+		if got != test.want {
+			t.Errorf("%s:\n got %q\nwant %q", test.fixture, got, test.want)
+		}
+	}
+}
+
+func TestSonarrPayloadErrors(t *testing.T) {
+	tests := []string{
+		`{"eventType": "Grab",`,
+		`not json`,
+		`{"series": {"title": "The Office"}}`,
+	}
+
+	for _, blob := range tests {
+		_, err := parseSonarrPayload([]byte(blob))
+		if err == nil {
+			t.Errorf("expected an error parsing %q", blob)
+		}
+	}
+}
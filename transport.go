@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// Message is an incoming chat message that commands can respond to.
+type Message struct {
+	User      string
+	Channel   string
+	Text      string
+	Timestamp string
+	// Sent by slack cat itself or another bot
+	Bot bool
+}
+
+// Reaction is an emoji being added to or removed from a message.
+type Reaction struct {
+	// Who reacted
+	User string
+	// Who wrote the message that was reacted to
+	ItemUser  string
+	Channel   string
+	Timestamp string
+	Emoji     string
+	Removed   bool
+}
+
+// OutgoingMessage is a message slack cat wants to post to a channel.
+type OutgoingMessage struct {
+	Channel         string
+	Text            string
+	ThreadTimestamp string
+}
+
+func NewOutgoingMessage(text string, channel string) *OutgoingMessage {
+	return &OutgoingMessage{Channel: channel, Text: text}
+}
+
+type ChatUser struct {
+	ID   string
+	Name string
+}
+
+type ChatChannel struct {
+	ID   string
+	Name string
+}
+
+// ChatClient is everything commands need from the chat service. Keeping
+// commands behind this interface means they don't care whether they are
+// talking to slack or something else entirely.
+type ChatClient interface {
+	SendMessage(msg *OutgoingMessage) error
+	AddReaction(emoji string, channel string, timestamp string) error
+	UploadFile(channel string, filename string, title string, r io.Reader) error
+	GetUserInfo(id string) (*ChatUser, error)
+	ListUsers() ([]ChatUser, error)
+	GetChannelInfo(id string) (*ChatChannel, error)
+	Disconnect() error
+}
+
+// sendMessage is for commands and listeners that post to chat themselves
+// rather than returning a reply. Once the router has given up on them ctx
+// is done and the message is dropped instead of turning up late.
+func sendMessage(ctx context.Context, chat ChatClient, msg *OutgoingMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return chat.SendMessage(msg)
+}
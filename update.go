@@ -6,8 +6,8 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"github.com/nlopes/slack"
 	"gopkg.in/src-d/go-git.v4"
 	"os"
 	"os/exec"
@@ -15,63 +15,68 @@ import (
 )
 
 type UpdateCommand struct {
-	rtm *slack.RTM
+	chat   ChatClient
+	prefix string
 }
 
-func (c *UpdateCommand) Matches(msg *slack.Msg) (bool, bool) {
-	return msg.Text == "?update", false
+func (c *UpdateCommand) Matches(msg *Message) bool {
+	return msg.Text == c.prefix+"update"
 }
 
-func (c *UpdateCommand) Execute(msg *slack.Msg) (*slack.OutgoingMessage, error) {
-	status := c.rtm.NewOutgoingMessage("Updating repo...", msg.Channel)
-	c.rtm.SendMessage(status)
+func (c *UpdateCommand) Execute(ctx context.Context, msg *Message) (*OutgoingMessage, error) {
+	status := NewOutgoingMessage("Updating repo...", msg.Channel)
+	err := sendMessage(ctx, c.chat, status)
+	if err != nil {
+		return nil, err
+	}
 
 	exe, err := os.Executable()
 	if err != nil {
-		status = c.rtm.NewOutgoingMessage("Could not determine repo location. Halting update.", msg.Channel)
+		status = NewOutgoingMessage("Could not determine repo location. Halting update.", msg.Channel)
 		return status, err
 	}
 
 	root := filepath.Dir(exe)
 	repo, err := git.PlainOpen(root)
 	if err != nil {
-		status = c.rtm.NewOutgoingMessage("Error opening repository. Halting update.", msg.Channel)
+		status = NewOutgoingMessage("Error opening repository. Halting update.", msg.Channel)
 		return status, err
 	}
 
 	err = repo.Pull(&git.PullOptions{})
 	if err == git.NoErrAlreadyUpToDate || err == nil {
-		status = c.rtm.NewOutgoingMessage("Repo updated. Recompiling...", msg.Channel)
-		c.rtm.SendMessage(status)
+		status = NewOutgoingMessage("Repo updated. Recompiling...", msg.Channel)
+		sendMessage(ctx, c.chat, status)
 	} else {
-		status = c.rtm.NewOutgoingMessage("Error pulling repository. Halting update.", msg.Channel)
+		status = NewOutgoingMessage("Error pulling repository. Halting update.", msg.Channel)
 		return status, err
 	}
 
 	var stderr bytes.Buffer
-	cmd := exec.Command("go", "build")
+	cmd := exec.CommandContext(ctx, "go", "build")
 	cmd.Stderr = &stderr
 	cmd.Dir = root
 	err = cmd.Run()
 
 	if err != nil {
-		status = c.rtm.NewOutgoingMessage(
+		status = NewOutgoingMessage(
 			fmt.Sprintf("Error recompiling (%s). Halting update.", stderr.String()),
 			msg.Channel,
 		)
 		return status, err
 	}
 
-	status = c.rtm.NewOutgoingMessage("Recompile done. Brb...", msg.Channel)
-	c.rtm.SendMessage(status)
-
-	c.rtm.Disconnect()
+	status = NewOutgoingMessage("Recompile done. Brb...", msg.Channel)
+	err = sendMessage(ctx, c.chat, status)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	return nil, c.chat.Disconnect()
 }
 
 func (c *UpdateCommand) GetSyntax() string {
-	return "?update"
+	return c.prefix + "update"
 }
 
 func (c *UpdateCommand) GetDescription() string {
@@ -81,6 +86,6 @@ func (c *UpdateCommand) GetDescription() string {
 func (c *UpdateCommand) Close() {
 }
 
-func NewUpdateCommand(rtm *slack.RTM) *UpdateCommand {
-	return &UpdateCommand{rtm}
+func NewUpdateCommand(chat ChatClient, cfg CommandConfig) *UpdateCommand {
+	return &UpdateCommand{chat, cfg.Prefix}
 }
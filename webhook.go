@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Largest webhook payload we are willing to read into memory
+const maxWebhookBodySize = 1 << 20
+
+// How long in flight webhook requests get to finish on shutdown
+const webhookShutdownTimeout = 5 * time.Second
+
+// CallbackError lets a SlackCatCallback control the HTTP status code
+// that gets returned to the webhook caller when handling fails.
+// Any other error returned from Handle results in a 500.
+type CallbackError struct {
+	Status int
+	Err    error
+}
+
+func (e *CallbackError) Error() string {
+	return e.Err.Error()
+}
+
+func NewCallbackError(status int, err error) *CallbackError {
+	return &CallbackError{status, err}
+}
+
+// WebhookServer serves webhook callbacks under /hooks/<name>
+// as well as prometheus metrics on /metrics.
+type WebhookServer struct {
+	srv       *http.Server
+	callbacks map[string]SlackCatCallback
+}
+
+func (s *WebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/hooks/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/hooks/"))
+	callback, ok := s.callbacks[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	//Read one byte past the limit so we can tell when it has been exceeded
+	blob, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, "could not read request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(blob) > maxWebhookBodySize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	start := time.Now()
+	err = callback.Handle(blob)
+
+	entry := logger.WithFields(logrus.Fields{
+		"callback":   name,
+		"latency_ms": time.Since(start).Seconds() * 1000,
+	})
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		if cbErr, ok := err.(*CallbackError); ok {
+			status = cbErr.Status
+		}
+
+		callbackDeliveries.WithLabelValues(name, strconv.Itoa(status)).Inc()
+		entry.WithError(err).WithField("status", status).Error("callback failed")
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	callbackDeliveries.WithLabelValues(name, strconv.Itoa(http.StatusNoContent)).Inc()
+	entry.Info("callback handled")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Start binds the webhook address, returning an error if it can't, then
+// serves webhook requests in the background.
+func (s *WebhookServer) Start() error {
+	addr := s.srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	logger.WithField("addr", ln.Addr().String()).Info("listening for webhooks")
+	go func() {
+		err := s.srv.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			logger.WithError(err).Error("webhook server failed")
+		}
+	}()
+
+	return nil
+}
+
+// Close stops accepting new webhook requests and waits
+// for any that are currently being handled to finish.
+func (s *WebhookServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		logger.WithError(err).Error("webhook server shutdown failed")
+	}
+}
+
+func NewWebhookServer(addr string, callbacks map[string]SlackCatCallback) *WebhookServer {
+	s := &WebhookServer{
+		callbacks: callbacks,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/hooks/", s)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	s.srv = &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	return s
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeCallback remembers what it was sent and fails with err
+type fakeCallback struct {
+	blobs [][]byte
+	err   error
+}
+
+func (c *fakeCallback) Handle(blob []byte) error {
+	c.blobs = append(c.blobs, blob)
+	return c.err
+}
+
+func (c *fakeCallback) Close() {
+}
+
+func serveWebhook(callbacks map[string]SlackCatCallback, method string, path string, body []byte) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	NewWebhookServer("", callbacks).ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	return rec
+}
+
+func TestWebhookRouting(t *testing.T) {
+	fake := &fakeCallback{}
+	callbacks := map[string]SlackCatCallback{"fake": fake}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, "/hooks/fake", http.StatusNoContent},
+		//Names aren't case sensitive
+		{http.MethodPost, "/hooks/FAKE", http.StatusNoContent},
+		{http.MethodPost, "/hooks/missing", http.StatusNotFound},
+		{http.MethodPost, "/hooks/", http.StatusNotFound},
+		{http.MethodPost, "/fake", http.StatusNotFound},
+		{http.MethodGet, "/hooks/fake", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/hooks/fake", http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		rec := serveWebhook(callbacks, test.method, test.path, []byte("{}"))
+		if rec.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, rec.Code, test.status)
+		}
+
+		if test.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("%s %s: got Allow %q, want %q", test.method, test.path, rec.Header().Get("Allow"), http.MethodPost)
+		}
+	}
+
+	if len(fake.blobs) != 2 || string(fake.blobs[0]) != "{}" {
+		t.Errorf("expected the callback to get both routed bodies, got %q", fake.blobs)
+	}
+}
+
+func TestWebhookBodyLimit(t *testing.T) {
+	fake := &fakeCallback{}
+	callbacks := map[string]SlackCatCallback{"fake": fake}
+
+	rec := serveWebhook(callbacks, http.MethodPost, "/hooks/fake", bytes.Repeat([]byte("a"), maxWebhookBodySize))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("got status %d for a body right at the limit, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec = serveWebhook(callbacks, http.MethodPost, "/hooks/fake", bytes.Repeat([]byte("a"), maxWebhookBodySize+1))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for a body over the limit, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	if len(fake.blobs) != 1 {
+		t.Errorf("expected only the body within the limit to be handled, %d were", len(fake.blobs))
+	}
+}
+
+func TestWebhookCallbackErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{nil, http.StatusNoContent},
+		{NewCallbackError(http.StatusBadRequest, errors.New("bad payload")), http.StatusBadRequest},
+		{NewCallbackError(http.StatusBadGateway, errors.New("slack is down")), http.StatusBadGateway},
+		//Anything that isn't a CallbackError is the callback's own fault
+		{errors.New("broken"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		callbacks := map[string]SlackCatCallback{"fake": &fakeCallback{err: test.err}}
+
+		rec := serveWebhook(callbacks, http.MethodPost, "/hooks/fake", []byte("{}"))
+		if rec.Code != test.status {
+			t.Errorf("%v: got status %d, want %d", test.err, rec.Code, test.status)
+		}
+
+		//The caller only gets the status, not the error
+		if test.err != nil && !strings.HasPrefix(rec.Body.String(), http.StatusText(test.status)) {
+			t.Errorf("%v: got body %q, want %q", test.err, rec.Body.String(), http.StatusText(test.status))
+		}
+	}
+}